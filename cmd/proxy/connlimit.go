@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+)
+
+var errTooManyConnections = errors.New("too many connections from source address")
+
+/*
+connLimitListener caps the number of concurrent connections per source IP.
+The source is looked up on first read rather than in Accept so that, when
+stacked on the PROXY protocol listener, the real client address is counted
+without blocking the accept loop.
+*/
+type connLimitListener struct {
+	net.Listener
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func newConnLimitListener(inner net.Listener, max int) *connLimitListener {
+	return &connLimitListener{
+		Listener: inner,
+		max:      max,
+		conns:    make(map[string]int),
+	}
+}
+
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, listener: l}, nil
+}
+
+func (l *connLimitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *connLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+func (l *connLimitListener) Count(ip string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conns[ip]
+}
+
+type limitedConn struct {
+	net.Conn
+	listener *connLimitListener
+
+	once      sync.Once
+	closeOnce sync.Once
+	ip        string
+	err       error
+}
+
+func (c *limitedConn) admit() error {
+	c.once.Do(func() {
+		ip := clientip.RemoteIP(c.Conn.RemoteAddr().String())
+		if !c.listener.acquire(ip) {
+			c.err = errTooManyConnections
+			c.Conn.Close()
+			return
+		}
+		c.ip = ip
+	})
+	return c.err
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	if err := c.admit(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.once.Do(func() {})
+		if c.ip != "" {
+			c.listener.release(c.ip)
+		}
+	})
+	return err
+}
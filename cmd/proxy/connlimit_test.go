@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConnLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := newConnLimitListener(inner, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	first, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	first.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(first), nil)
+	if err != nil {
+		t.Fatalf("First connection should be served: %v", err)
+	}
+	resp.Body.Close()
+
+	// First connection is kept alive, so a second one from the same IP is over the cap
+	second, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	second.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(second), nil); err == nil {
+		t.Error("Expected second connection from the same IP to be rejected")
+	}
+
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for listener.Count("127.0.0.1") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected connection slot to be released, still %d", listener.Count("127.0.0.1"))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
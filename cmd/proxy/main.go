@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
 	"github.com/smartcraze/gothrottle/internal/config"
 	"github.com/smartcraze/gothrottle/internal/middleware"
 	"github.com/smartcraze/gothrottle/internal/proxy"
@@ -28,13 +32,38 @@ func main() {
 			cfg.RateLimit.RequestsPerMinute, requestsPerSec, cfg.RateLimit.Burst)
 	}
 	for i, route := range cfg.Routes {
-		log.Printf("  Route %d: %s -> %s", i+1, route.Path, route.Target)
+		log.Printf("  Route %d: %s -> %s", i+1, route.Path, strings.Join(route.UpstreamURLs(), ", "))
+	}
+	if len(cfg.Server.TrustedProxies.CIDRs) > 0 {
+		log.Printf("  Trusted proxies: %v (headers: %v, hops: %d)",
+			cfg.Server.TrustedProxies.CIDRs, cfg.Server.TrustedProxies.Headers, cfg.Server.TrustedProxies.Hops)
+	}
+
+	resolver, err := clientip.NewResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
 	}
 
 	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies.CIDRs); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
+	r.RemoteIPHeaders = cfg.Server.TrustedProxies.Headers
+
 	r.Use(gin.Recovery())
+	r.Use(middleware.ClientIP(resolver))
 	r.Use(middleware.Logger())
 
+	if cfg.Server.MinBodyRate > 0 {
+		r.Use(middleware.MinBodyRate(cfg.Server.MinBodyRate, cfg.Server.BodyRateGrace))
+	}
+
+	if cfg.LoadShedding.Enabled {
+		loadShedder := middleware.NewLoadShedder(cfg.LoadShedding)
+		r.Use(loadShedder.Shed())
+		log.Printf("  Load shedding: max %d in flight, queue %d", cfg.LoadShedding.MaxInFlight, cfg.LoadShedding.MaxQueue)
+	}
+
 	rateLimiter := middleware.NewRateLimiter(requestsPerSec, cfg.RateLimit.Burst)
 	r.Use(rateLimiter.Limit())
 
@@ -45,16 +74,55 @@ func main() {
 		})
 	})
 
-	proxyHandler, err := proxy.NewHandler(cfg.Routes)
+	proxyHandler, err := proxy.NewHandlerWithBandwidth(cfg.Routes, cfg.Bandwidth)
 	if err != nil {
 		log.Fatalf("Failed to create proxy handler: %v", err)
 	}
 
+	proxyHandler.StartHealthChecks(context.Background())
+
+	if cfg.Metrics.Enabled {
+		r.GET(cfg.Metrics.Path, func(c *gin.Context) {
+			c.Header("Content-Type", "text/plain; version=0.0.4")
+			if err := proxyHandler.WriteMetrics(c.Writer); err != nil {
+				log.Printf("Failed to write metrics: %v", err)
+			}
+		})
+		log.Printf("  Metrics: %s", cfg.Metrics.Path)
+	}
+
 	r.NoRoute(proxyHandler.Handle)
 
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
+
+	if cfg.Server.ProxyProtocol.Enabled {
+		listener, err = newProxyProtoListener(listener, cfg.Server.ProxyProtocol)
+		if err != nil {
+			log.Fatalf("Failed to configure proxy protocol: %v", err)
+		}
+		log.Printf("PROXY protocol enabled for %v", cfg.Server.ProxyProtocol.AllowedCIDRs)
+	}
+
+	if cfg.Server.MaxConnsPerIP > 0 {
+		listener = newConnLimitListener(listener, cfg.Server.MaxConnsPerIP)
+		log.Printf("Connection limit: %d per source IP", cfg.Server.MaxConnsPerIP)
+	}
+
+	server := &http.Server{
+		Handler:           r.Handler(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
 	log.Printf("Starting reverse proxy server on %s", addr)
-	if err := r.Run(addr); err != nil {
+	if err := server.Serve(listener); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
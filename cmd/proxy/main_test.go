@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+	"github.com/smartcraze/gothrottle/internal/middleware"
+	"github.com/smartcraze/gothrottle/internal/proxy"
+)
+
+// logLines collects log output written from server goroutines.
+type logLines chan string
+
+func (l logLines) Write(p []byte) (int, error) {
+	select {
+	case l <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+func TestWebSocketThroughMiddleware(t *testing.T) {
+	// The backend accepts any upgrade and echoes the raw bytes it receives
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	defer backend.Close()
+
+	resolver, err := clientip.NewResolver(config.TrustedProxies{})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	handler, err := proxy.NewHandler([]config.Route{{
+		Path:      "/ws",
+		Target:    backend.URL,
+		WebSocket: &config.WebSocket{MessageRate: 2, MessageBurst: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	lines := make(logLines, 100)
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(lines)
+
+	// Same chain as main, with room for a single request in flight
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(middleware.ClientIP(resolver))
+	r.Use(middleware.Logger())
+	r.Use(middleware.NewLoadShedder(config.LoadShedding{Enabled: true, MaxInFlight: 1}).Shed())
+	r.Use(middleware.NewRateLimiter(100, 100).Limit())
+	r.GET("/ping", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.NoRoute(handler.Handle)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /ws/feed HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+
+	// The upgraded connection must give its load shedding slot back
+	ping, err := http.Get(server.URL + "/ping")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	ping.Body.Close()
+	if ping.StatusCode != http.StatusOK {
+		t.Errorf("Expected request next to an open WebSocket to be admitted, got %d", ping.StatusCode)
+	}
+
+	// Five masked one-byte text frames at 2 messages/s with a burst of 1
+	frame := []byte{0x81, 0x81, 0, 0, 0, 0, 'm'}
+	start := time.Now()
+	conn.Write([]byte(strings.Repeat(string(frame), 5)))
+	echo := make([]byte, 5*len(frame))
+	if _, err := io.ReadFull(reader, echo); err != nil {
+		t.Fatalf("Expected messages to be echoed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("Expected 5 messages at 2/s to take about 2s, took %v", elapsed)
+	}
+
+	conn.Close()
+	expected := "[GET] /ws/feed 127.0.0.1 101"
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if strings.Contains(line, expected) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected log line containing %q", expected)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+var proxyProtoV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const proxyProtoV1MaxLength = 107
+
+var errMissingProxyHeader = errors.New("proxy protocol: missing header")
+
+/*
+proxyProtoListener wraps a listener so connections arriving from trusted load
+balancers have their PROXY protocol header consumed and the original source
+address exposed through RemoteAddr. Connections from other sources are passed
+through untouched so they cannot forge an address.
+*/
+type proxyProtoListener struct {
+	net.Listener
+	allowed       []*net.IPNet
+	headerTimeout time.Duration
+}
+
+func newProxyProtoListener(inner net.Listener, cfg config.ProxyProtocol) (*proxyProtoListener, error) {
+	listener := &proxyProtoListener{
+		Listener:      inner,
+		headerTimeout: cfg.HeaderTimeout,
+	}
+
+	for _, cidr := range cfg.AllowedCIDRs {
+		network, err := config.ParseNetwork(cidr)
+		if err != nil {
+			return nil, err
+		}
+		listener.allowed = append(listener.allowed, network)
+	}
+
+	return listener, nil
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.isAllowed(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	return &proxyProtoConn{Conn: conn, headerTimeout: l.headerTimeout}, nil
+}
+
+func (l *proxyProtoListener) isAllowed(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l.allowed {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+proxyProtoConn reads the PROXY header lazily on first use so the accept loop
+is never blocked by a slow peer; net/http calls RemoteAddr from the
+connection's own goroutine.
+*/
+type proxyProtoConn struct {
+	net.Conn
+	headerTimeout time.Duration
+
+	once   sync.Once
+	reader *bufio.Reader
+	source net.Addr
+	dest   net.Addr
+	err    error
+}
+
+func (c *proxyProtoConn) readHeader() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		if c.headerTimeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+
+		c.source, c.dest, c.err = parseProxyHeader(c.reader)
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.source != nil {
+		return c.source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.dest != nil {
+		return c.dest
+	}
+	return c.Conn.LocalAddr()
+}
+
+/*
+parseProxyHeader consumes a v1 or v2 header from r. Nil addresses are
+returned for headers that carry no address information (v1 UNKNOWN, v2 LOCAL
+or non-IP families), in which case the connection addresses are kept.
+*/
+func parseProxyHeader(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	sig, err := r.Peek(len(proxyProtoV2Signature))
+	if err != nil {
+		return nil, nil, fmt.Errorf("proxy protocol: reading header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(sig, proxyProtoV2Signature):
+		return parseProxyHeaderV2(r)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		return parseProxyHeaderV1(r)
+	default:
+		return nil, nil, errMissingProxyHeader
+	}
+}
+
+func parseProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < proxyProtoV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("proxy protocol: reading v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("proxy protocol: v1 header too long or not CRLF terminated")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("proxy protocol: malformed v1 header %q", line)
+	}
+
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, nil, fmt.Errorf("proxy protocol: unsupported v1 protocol %q", fields[1])
+	}
+
+	source, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dest, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return source, dest, nil
+}
+
+func parseV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("proxy protocol: invalid v1 address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: invalid v1 port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func parseProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("proxy protocol: reading v2 header: %w", err)
+	}
+
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("proxy protocol: unsupported version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("proxy protocol: reading v2 addresses: %w", err)
+	}
+
+	switch command {
+	case 0x0:
+		return nil, nil, nil
+	case 0x1:
+	default:
+		return nil, nil, fmt.Errorf("proxy protocol: unsupported v2 command %d", command)
+	}
+
+	switch family >> 4 {
+	case 0x1:
+		if len(payload) < 12 {
+			return nil, nil, errors.New("proxy protocol: short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))},
+			&net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))},
+			nil
+	case 0x2:
+		if len(payload) < 36 {
+			return nil, nil, errors.New("proxy protocol: short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))},
+			&net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))},
+			nil
+	default:
+		return nil, nil, nil
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestParseProxyHeaderV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.10 10.0.0.5 51234 8080\r\nGET / HTTP/1.1\r\n"))
+
+	source, dest, err := parseProxyHeader(r)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	if source.String() != "192.0.2.10:51234" {
+		t.Errorf("Expected source 192.0.2.10:51234, got %s", source)
+	}
+	if dest.String() != "10.0.0.5:8080" {
+		t.Errorf("Expected destination 10.0.0.5:8080, got %s", dest)
+	}
+
+	rest, _ := r.ReadString('\n')
+	if rest != "GET / HTTP/1.1\r\n" {
+		t.Errorf("Expected payload to follow header, got %q", rest)
+	}
+}
+
+func TestParseProxyHeaderV1Unknown(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+
+	source, dest, err := parseProxyHeader(r)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	if source != nil || dest != nil {
+		t.Errorf("Expected no addresses for UNKNOWN, got %v %v", source, dest)
+	}
+}
+
+func TestParseProxyHeaderV2(t *testing.T) {
+	header := buildProxyHeaderV2(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 40000, 443)
+	r := bufio.NewReader(bytes.NewReader(append(header, "payload"...)))
+
+	source, _, err := parseProxyHeader(r)
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	if source.String() != "[2001:db8::1]:40000" {
+		t.Errorf("Expected source [2001:db8::1]:40000, got %s", source)
+	}
+
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "payload" {
+		t.Errorf("Expected payload after header, got %q", rest)
+	}
+}
+
+func TestParseProxyHeaderInvalid(t *testing.T) {
+	tests := []string{
+		"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"PROXY TCP4 not-an-ip 10.0.0.5 1 2\r\n",
+		"PROXY TCP4 192.0.2.10 10.0.0.5 51234\r\n",
+		"PROXY TCP4 192.0.2.10 10.0.0.5 51234 8080\n",
+	}
+
+	for _, input := range tests {
+		if _, _, err := parseProxyHeader(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestProxyProtoListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := newProxyProtoListener(inner, config.ProxyProtocol{
+		Enabled:       true,
+		AllowedCIDRs:  []string{"127.0.0.1"},
+		HeaderTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("PROXY TCP4 198.51.100.7 127.0.0.1 40000 8080\r\n"))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "198.51.100.7:40000" {
+		t.Errorf("Expected RemoteAddr from PROXY header, got %s", body)
+	}
+}
+
+func TestProxyProtoListenerRejectsMissingHeader(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := newProxyProtoListener(inner, config.ProxyProtocol{
+		Enabled:       true,
+		AllowedCIDRs:  []string{"127.0.0.0/8"},
+		HeaderTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+		t.Error("Expected connection without PROXY header to be closed")
+	}
+}
+
+func buildProxyHeaderV2(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyProtoV2Signature)
+	buf.WriteByte(0x21)
+	buf.WriteByte(0x21)
+	binary.Write(&buf, binary.BigEndian, uint16(36))
+	buf.Write(src.To16())
+	buf.Write(dst.To16())
+	binary.Write(&buf, binary.BigEndian, srcPort)
+	binary.Write(&buf, binary.BigEndian, dstPort)
+	return buf.Bytes()
+}
@@ -0,0 +1,253 @@
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+Resolver determines the real client IP of a request. Forwarding headers are
+only consulted when the immediate peer is a trusted proxy, so clients talking
+to the proxy directly cannot spoof their rate-limit key.
+*/
+type Resolver struct {
+	trusted   []*net.IPNet
+	headers   []string
+	hops      int
+	overwrite bool
+}
+
+func NewResolver(cfg config.TrustedProxies) (*Resolver, error) {
+	resolver := &Resolver{
+		hops:      cfg.Hops,
+		overwrite: cfg.ForwardedHeaders == "overwrite",
+	}
+
+	for _, header := range cfg.Headers {
+		resolver.headers = append(resolver.headers, http.CanonicalHeaderKey(header))
+	}
+
+	for _, cidr := range cfg.CIDRs {
+		network, err := config.ParseNetwork(cidr)
+		if err != nil {
+			return nil, err
+		}
+		resolver.trusted = append(resolver.trusted, network)
+	}
+
+	return resolver, nil
+}
+
+/*
+Resolve returns the client IP for the request. The configured headers are
+tried in order and the first one yielding a valid address wins; when none
+does, or the peer is not trusted, the peer address itself is returned.
+*/
+func (r *Resolver) Resolve(req *http.Request) string {
+	remote := RemoteIP(req.RemoteAddr)
+	peer := net.ParseIP(remote)
+	if peer == nil || !r.isTrusted(peer) {
+		return remote
+	}
+
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		var chain []net.IP
+		switch header {
+		case "X-Forwarded-For":
+			chain = parseForwardedFor(values)
+		case "Forwarded":
+			chain = parseForwarded(values)
+		default:
+			if ip := net.ParseIP(strings.TrimSpace(values[0])); ip != nil {
+				return ip.String()
+			}
+			continue
+		}
+
+		if ip := r.pick(chain); ip != nil {
+			return ip.String()
+		}
+	}
+
+	return remote
+}
+
+/*
+Forwarding says which forwarding headers already on a request may be passed
+upstream. Trusted peers keep them all. Other peers can at most have this hop
+appended to their X-Forwarded-For and Forwarded lists, since a forged
+X-Forwarded-Host or -Proto would steer the absolute URLs the upstream builds.
+*/
+type Forwarding int
+
+const (
+	// ForwardKeep keeps every forwarding header of a trusted peer
+	ForwardKeep Forwarding = iota
+	// ForwardAppend keeps the client lists and replaces proto, host and port
+	ForwardAppend
+	// ForwardDrop discards every forwarding header
+	ForwardDrop
+)
+
+/*
+Forwarding decides what happens to the forwarding headers of req: kept for
+trusted peers, otherwise appended to or dropped depending on the mode.
+*/
+func (r *Resolver) Forwarding(req *http.Request) Forwarding {
+	peer := net.ParseIP(RemoteIP(req.RemoteAddr))
+	switch {
+	case peer != nil && r.isTrusted(peer):
+		return ForwardKeep
+	case r.overwrite:
+		return ForwardDrop
+	}
+	return ForwardAppend
+}
+
+/*
+pick selects the client entry from a proxy chain ordered client-first. With
+a fixed hop count the entry appended by the outermost trusted proxy is used;
+otherwise the chain is walked right to left skipping trusted addresses.
+*/
+func (r *Resolver) pick(chain []net.IP) net.IP {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	if r.hops > 0 {
+		idx := len(chain) - r.hops
+		if idx < 0 {
+			idx = 0
+		}
+		return chain[idx]
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !r.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseForwardedFor(values []string) []net.IP {
+	var chain []net.IP
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			ip := net.ParseIP(strings.TrimSpace(entry))
+			if ip == nil {
+				return nil
+			}
+			chain = append(chain, ip)
+		}
+	}
+	return chain
+}
+
+/*
+parseForwarded extracts the for= parameters of an RFC 7239 Forwarded header.
+Obfuscated or "unknown" identifiers make the whole header unusable since the
+chain can no longer be walked reliably.
+*/
+func parseForwarded(values []string) []net.IP {
+	var chain []net.IP
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				ip := net.ParseIP(stripPort(strings.Trim(val, `"`)))
+				if ip == nil {
+					return nil
+				}
+				chain = append(chain, ip)
+			}
+		}
+	}
+	return chain
+}
+
+func stripPort(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if strings.Count(node, ":") == 1 {
+		host, _, _ := strings.Cut(node, ":")
+		return host
+	}
+	return node
+}
+
+/*
+RemoteIP strips the port from a RemoteAddr-style address.
+*/
+func RemoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		return strings.TrimSpace(remoteAddr)
+	}
+	return host
+}
+
+type contextKey struct{}
+
+type forwardingKey struct{}
+
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(contextKey{}).(string)
+	return ip, ok
+}
+
+/*
+FromRequest returns the IP stored by the resolving middleware, falling back
+to the peer address for requests that never went through it.
+*/
+func FromRequest(req *http.Request) string {
+	if ip, ok := FromContext(req.Context()); ok {
+		return ip
+	}
+	return RemoteIP(req.RemoteAddr)
+}
+
+func WithForwarding(ctx context.Context, f Forwarding) context.Context {
+	return context.WithValue(ctx, forwardingKey{}, f)
+}
+
+/*
+ForwardingFromRequest returns the decision stored by the resolving
+middleware. Requests that never went through it are not known to come from
+a trusted peer, so they are treated as untrusted in append mode.
+*/
+func ForwardingFromRequest(req *http.Request) Forwarding {
+	if f, ok := req.Context().Value(forwardingKey{}).(Forwarding); ok {
+		return f
+	}
+	return ForwardAppend
+}
@@ -0,0 +1,154 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestNewResolverInvalidCIDR(t *testing.T) {
+	_, err := NewResolver(config.TrustedProxies{CIDRs: []string{"10.0.0.0/33"}})
+	if err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.TrustedProxies
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "no trusted proxies ignores headers",
+			cfg:        config.TrustedProxies{Headers: []string{"X-Forwarded-For"}},
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "untrusted peer cannot spoof",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"X-Forwarded-For"}},
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "trusted peer skips trusted chain entries",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"X-Forwarded-For"}},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "fixed hops peels from the right",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.1"}, Headers: []string{"X-Forwarded-For"}, Hops: 2},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 192.0.2.9"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "forwarded header",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"Forwarded"}},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`},
+			expected:   "2001:db8:cafe::17",
+		},
+		{
+			name:       "single value header",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"CF-Connecting-IP"}},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"CF-Connecting-IP": "192.0.2.1"},
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "falls through to next header",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"X-Real-IP", "X-Forwarded-For"}},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "garbage", "X-Forwarded-For": "192.0.2.2"},
+			expected:   "192.0.2.2",
+		},
+		{
+			name:       "malformed chain falls back to peer",
+			cfg:        config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, Headers: []string{"X-Forwarded-For"}},
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, not-an-ip"},
+			expected:   "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewResolver(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create resolver: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			if got := resolver.Resolve(req); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:4321"
+
+	if got := FromRequest(req); got != "192.0.2.1" {
+		t.Errorf("Expected fallback to peer address, got %s", got)
+	}
+
+	req = req.WithContext(WithIP(req.Context(), "198.51.100.1"))
+	if got := FromRequest(req); got != "198.51.100.1" {
+		t.Errorf("Expected stored IP, got %s", got)
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		remoteAddr string
+		expected   Forwarding
+	}{
+		{"append appends to untrusted", "append", "203.0.113.5:1234", ForwardAppend},
+		{"append keeps trusted", "append", "10.1.2.3:1234", ForwardKeep},
+		{"overwrite drops untrusted", "overwrite", "203.0.113.5:1234", ForwardDrop},
+		{"overwrite keeps trusted", "overwrite", "10.1.2.3:1234", ForwardKeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewResolver(config.TrustedProxies{CIDRs: []string{"10.0.0.0/8"}, ForwardedHeaders: tt.mode})
+			if err != nil {
+				t.Fatalf("Failed to create resolver: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if got := resolver.Forwarding(req); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := ForwardingFromRequest(req); got != ForwardAppend {
+		t.Errorf("Expected untrusted append without a stored decision, got %v", got)
+	}
+	req = req.WithContext(WithForwarding(req.Context(), ForwardDrop))
+	if got := ForwardingFromRequest(req); got != ForwardDrop {
+		t.Errorf("Expected stored decision to be used, got %v", got)
+	}
+}
@@ -1,12 +1,266 @@
 package config
 
+import "time"
+
 /*
 Route represents a path-based routing rule that maps incoming request paths
-to upstream backend targets.
+to upstream backend targets. Either a single Target or a list of Targets
+load balanced per request may be given. Hosts, Methods, Headers, Query and
+SourceCIDRs further restrict which requests the route matches; a host may
+start with "*." to match any subdomain, and a header or query value of "*"
+only requires the key to be present. Match selects how Path is interpreted:
+"prefix" (the default), "regex" or "glob".
 */
 type Route struct {
-	Path   string `yaml:"path"`
-	Target string `yaml:"target"`
+	Name             string            `yaml:"name"`
+	Path             string            `yaml:"path"`
+	Match            string            `yaml:"match"`
+	Hosts            []string          `yaml:"hosts"`
+	Methods          []string          `yaml:"methods"`
+	Headers          map[string]string `yaml:"headers"`
+	Query            map[string]string `yaml:"query"`
+	SourceCIDRs      []string          `yaml:"source_cidrs"`
+	Target           string            `yaml:"target"`
+	Targets          []Upstream        `yaml:"targets"`
+	StripPrefix      string            `yaml:"strip_prefix"`
+	AddPrefix        string            `yaml:"add_prefix"`
+	Rewrite          *Rewrite          `yaml:"rewrite"`
+	RequestHeaders   *HeaderRules      `yaml:"request_headers"`
+	ResponseHeaders  *HeaderRules      `yaml:"response_headers"`
+	LoadBalancing    LoadBalancing     `yaml:"load_balancing"`
+	StickySession    *StickySession    `yaml:"sticky_session"`
+	HealthCheck      *HealthCheck      `yaml:"health_check"`
+	OutlierDetection *OutlierDetection `yaml:"outlier_detection"`
+	CircuitBreaker   *CircuitBreaker   `yaml:"circuit_breaker"`
+	Retry            *Retry            `yaml:"retry"`
+	Hedging          *Hedging          `yaml:"hedging"`
+	WebSocket        *WebSocket        `yaml:"websocket"`
+	FlushInterval    time.Duration     `yaml:"flush_interval"`
+	Streaming        bool              `yaml:"streaming"`
+	Transport        Transport         `yaml:"transport"`
+	Bandwidth        *Bandwidth        `yaml:"bandwidth"`
+}
+
+/*
+Transport tunes the connections to a route's upstreams. ResponseHeaderTimeout
+bounds how long a backend may take to start answering, while RequestTimeout
+is an overall deadline including the response body, lifted for streamed
+responses. KeepAlive is the TCP keep-alive period.
+*/
+type Transport struct {
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	RequestTimeout        time.Duration `yaml:"request_timeout"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	KeepAlive             time.Duration `yaml:"keep_alive"`
+	DisableKeepAlives     bool          `yaml:"disable_keep_alives"`
+}
+
+/*
+WebSocket limits the WebSocket connections proxied by a route.
+MaxConnectionsPerClient caps the concurrent connections of one client IP,
+and MessageRate throttles the messages each client sends upstream, allowing
+bursts of MessageBurst messages. Zero values disable a limit.
+*/
+type WebSocket struct {
+	MaxConnectionsPerClient int     `yaml:"max_connections_per_client"`
+	MessageRate             float64 `yaml:"message_rate"`
+	MessageBurst            int     `yaml:"message_burst"`
+}
+
+/*
+Hedging sends a duplicate of a GET or HEAD request to another target when
+the first one has not answered within the Percentile of recent response
+times, and uses whichever response arrives first. MinDelay is the lower
+bound of the hedge delay and is used until enough samples were collected.
+*/
+type Hedging struct {
+	Percentile float64       `yaml:"percentile"`
+	MinDelay   time.Duration `yaml:"min_delay"`
+	MaxHedges  int           `yaml:"max_hedges"`
+}
+
+/*
+Retry re-sends failed upstream requests, preferably to a different target.
+Attempts counts the first try. RetryOn lists the failure kinds that are
+retried (connect_failure, timeout, error, gateway_error, 5xx) in addition to
+StatusCodes. Only idempotent methods are retried unless NonIdempotent is set,
+and request bodies larger than MaxBodySize are never replayed. Retries are
+capped at BudgetPercent of the route's requests plus MinRetriesPerSecond.
+*/
+type Retry struct {
+	Attempts            int           `yaml:"attempts"`
+	PerTryTimeout       time.Duration `yaml:"per_try_timeout"`
+	Backoff             time.Duration `yaml:"backoff"`
+	MaxBackoff          time.Duration `yaml:"max_backoff"`
+	RetryOn             []string      `yaml:"retry_on"`
+	StatusCodes         []int         `yaml:"status_codes"`
+	NonIdempotent       bool          `yaml:"non_idempotent"`
+	BudgetPercent       float64       `yaml:"budget_percent"`
+	MinRetriesPerSecond int           `yaml:"min_retries_per_second"`
+	MaxBodySize         ByteSize      `yaml:"max_body_size"`
+}
+
+/*
+CircuitBreaker opens the circuit of an upstream once at least MinRequests
+were seen within Window and ErrorRatio of them failed. An open circuit
+rejects traffic for OpenDuration, after which HalfOpenRequests trial
+requests must succeed in a row to close it again.
+*/
+type CircuitBreaker struct {
+	ErrorRatio       float64       `yaml:"error_ratio"`
+	MinRequests      int           `yaml:"min_requests"`
+	Window           time.Duration `yaml:"window"`
+	OpenDuration     time.Duration `yaml:"open_duration"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+/*
+OutlierDetection passively ejects upstreams that return Consecutive5xx
+server errors or connection failures in a row. The ejection lasts
+BaseEjectionTime and doubles on every repeat offence up to MaxEjectionTime.
+At most MaxEjectionPercent of a route's targets are ejected at once.
+*/
+type OutlierDetection struct {
+	Consecutive5xx     int           `yaml:"consecutive_5xx"`
+	BaseEjectionTime   time.Duration `yaml:"base_ejection_time"`
+	MaxEjectionTime    time.Duration `yaml:"max_ejection_time"`
+	MaxEjectionPercent int           `yaml:"max_ejection_percent"`
+}
+
+/*
+HealthCheck configures active probing of a route's upstreams. A target is
+marked unhealthy after UnhealthyThreshold consecutive failed probes and
+healthy again after HealthyThreshold consecutive successes. An empty
+ExpectedStatus accepts any 2xx response.
+*/
+type HealthCheck struct {
+	Path               string        `yaml:"path"`
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	ExpectedStatus     []int         `yaml:"expected_status"`
+	HealthyThreshold   int           `yaml:"healthy_threshold"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"`
+}
+
+/*
+Rewrite replaces matches of Regex in the request path with Replacement,
+which may refer to capture groups as $1 or ${name}. On regex and glob
+routes Regex may be left empty to reuse the captures of the route path.
+*/
+type Rewrite struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+}
+
+/*
+HeaderRules edits the headers passing through a route. Remove runs first,
+then Rename, Set (replacing existing values) and Add (appending a value).
+Values may contain the template variables {client_ip}, {route}, {path},
+{request_id}, {method}, {host} and {upstream}.
+*/
+type HeaderRules struct {
+	Set    map[string]string `yaml:"set"`
+	Add    map[string]string `yaml:"add"`
+	Remove []string          `yaml:"remove"`
+	Rename map[string]string `yaml:"rename"`
+}
+
+/*
+StickySession pins a client to the upstream chosen for its first request
+using an HMAC-signed affinity cookie. Secret is the signing key; when empty a
+random key is generated at startup, so cookies do not survive restarts. A
+zero TTL issues a browser-session cookie.
+*/
+type StickySession struct {
+	CookieName string        `yaml:"cookie_name"`
+	Secret     string        `yaml:"secret"`
+	TTL        time.Duration `yaml:"ttl"`
+	Path       string        `yaml:"path"`
+	Domain     string        `yaml:"domain"`
+	Secure     bool          `yaml:"secure"`
+	HTTPOnly   *bool         `yaml:"http_only"`
+	SameSite   string        `yaml:"same_site"`
+}
+
+/*
+LoadBalancing selects how a route spreads requests over its targets:
+"round_robin" (default, weighted), "least_conn" (fewest in-flight requests),
+"p2c" (power of two random choices), "ewma" (peak EWMA of response latency),
+or the consistent-hash strategies "ring_hash" and "maglev".
+
+Decay is the time constant of the latency average. HashKey names the request
+attribute hashed by the consistent-hash strategies: "client_ip", "path",
+"header:<name>" or "cookie:<name>". BoundedLoad, when greater than 1, caps any
+target at that multiple of the average in-flight load, spilling excess keys
+to the next target.
+*/
+type LoadBalancing struct {
+	Strategy    string        `yaml:"strategy"`
+	Decay       time.Duration `yaml:"decay"`
+	HashKey     string        `yaml:"hash_key"`
+	BoundedLoad float64       `yaml:"bounded_load"`
+}
+
+/*
+Upstream is one backend of a route. In YAML it is either a plain URL string
+or a mapping with url and weight; weight defaults to 1.
+*/
+type Upstream struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+func (u *Upstream) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var url string
+	if err := unmarshal(&url); err == nil {
+		*u = Upstream{URL: url, Weight: 1}
+		return nil
+	}
+
+	type plain Upstream
+	raw := plain{Weight: 1}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*u = Upstream(raw)
+	return nil
+}
+
+/*
+Upstreams returns every backend of the route, whether configured through
+target or targets.
+*/
+func (r *Route) Upstreams() []Upstream {
+	if len(r.Targets) > 0 {
+		return r.Targets
+	}
+	if r.Target != "" {
+		return []Upstream{{URL: r.Target, Weight: 1}}
+	}
+	return nil
+}
+
+/*
+UpstreamURLs returns the URLs of every backend of the route.
+*/
+func (r *Route) UpstreamURLs() []string {
+	var urls []string
+	for _, upstream := range r.Upstreams() {
+		urls = append(urls, upstream.URL)
+	}
+	return urls
+}
+
+/*
+Bandwidth limits request body (upload) and response body (download)
+throughput per client. A zero rate leaves that direction unthrottled.
+*/
+type Bandwidth struct {
+	Upload   ByteRate `yaml:"upload"`
+	Download ByteRate `yaml:"download"`
 }
 
 /*
@@ -34,8 +288,95 @@ func (r *RateLimit) GetRequestsPerSecond() float64 {
 	return 1.0
 }
 
+/*
+TrustedProxies controls how the real client IP is recovered when the proxy
+sits behind other proxies or load balancers. Forwarding headers are only
+honoured when the immediate peer falls inside one of the CIDRs, and Hops
+fixes how many trusted proxies to peel off the X-Forwarded-For/Forwarded
+chain (0 walks the chain skipping every trusted address). ForwardedHeaders
+decides what happens to forwarding headers sent by untrusted peers when the
+request is proxied upstream: "append" keeps their X-Forwarded-For and
+Forwarded lists and adds this hop, while "overwrite" replaces them. Their
+X-Forwarded-Proto, -Host and -Port are replaced in both modes.
+*/
+type TrustedProxies struct {
+	CIDRs            []string `yaml:"cidrs"`
+	Headers          []string `yaml:"headers"`
+	Hops             int      `yaml:"hops"`
+	ForwardedHeaders string   `yaml:"forwarded_headers"`
+}
+
+/*
+ProxyProtocol enables parsing of HAProxy PROXY protocol (v1 and v2) headers on
+incoming connections. Only connections from AllowedCIDRs are expected to carry
+a header; everything else is served as-is.
+*/
+type ProxyProtocol struct {
+	Enabled       bool          `yaml:"enabled"`
+	AllowedCIDRs  []string      `yaml:"allowed_cidrs"`
+	HeaderTimeout time.Duration `yaml:"header_timeout"`
+}
+
+/*
+ServerConfig holds listener settings. The timeouts map directly onto
+http.Server; MaxConnsPerIP caps concurrent connections from one source
+address and MinBodyRate closes uploads that trickle in slower than the given
+rate once BodyRateGrace has passed, which together defeat slowloris-style
+clients.
+*/
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port              int            `yaml:"port"`
+	TrustedProxies    TrustedProxies `yaml:"trusted_proxies"`
+	ProxyProtocol     ProxyProtocol  `yaml:"proxy_protocol"`
+	ReadHeaderTimeout time.Duration  `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration  `yaml:"read_timeout"`
+	WriteTimeout      time.Duration  `yaml:"write_timeout"`
+	IdleTimeout       time.Duration  `yaml:"idle_timeout"`
+	MaxHeaderBytes    int            `yaml:"max_header_bytes"`
+	MaxConnsPerIP     int            `yaml:"max_conns_per_ip"`
+	MinBodyRate       ByteRate       `yaml:"min_body_rate"`
+	BodyRateGrace     time.Duration  `yaml:"body_rate_grace"`
+}
+
+/*
+PriorityClass groups requests that share a shedding priority. A request joins
+the first class whose path prefixes, header values or API keys match it.
+ShedAt is the fraction of the global in-flight and queue capacity the class
+may use, so classes with a lower ShedAt are rejected first under load.
+Exempt classes are never shed, which is what health checks should use.
+*/
+type PriorityClass struct {
+	Name    string            `yaml:"name"`
+	Paths   []string          `yaml:"paths"`
+	Headers map[string]string `yaml:"headers"`
+	APIKeys []string          `yaml:"api_keys"`
+	ShedAt  float64           `yaml:"shed_at"`
+	Exempt  bool              `yaml:"exempt"`
+}
+
+/*
+LoadShedding caps the number of requests being proxied at once. Requests over
+their class limit wait up to QueueTimeout for a slot before being rejected
+with 503.
+*/
+type LoadShedding struct {
+	Enabled      bool            `yaml:"enabled"`
+	MaxInFlight  int             `yaml:"max_in_flight"`
+	MaxQueue     int             `yaml:"max_queue"`
+	QueueTimeout time.Duration   `yaml:"queue_timeout"`
+	APIKeyHeader string          `yaml:"api_key_header"`
+	DefaultClass string          `yaml:"default_class"`
+	Classes      []PriorityClass `yaml:"classes"`
+}
+
+/*
+Metrics serves the upstream metrics in the Prometheus text format on Path.
+The endpoint is off by default, since it shadows any proxied path it uses
+and reveals upstream addresses.
+*/
+type Metrics struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
 }
 
 /*
@@ -43,8 +384,11 @@ Config holds the complete application configuration including server settings,
 rate limiting parameters, and routing rules.
 */
 type Config struct {
-	Routes    []Route      `yaml:"routes"`
-	RateLimit RateLimit    `yaml:"rate_limit"`
-	Server    ServerConfig `yaml:"server"`
+	Routes       []Route      `yaml:"routes"`
+	RateLimit    RateLimit    `yaml:"rate_limit"`
+	Server       ServerConfig `yaml:"server"`
+	LoadShedding LoadShedding `yaml:"load_shedding"`
+	Bandwidth    Bandwidth    `yaml:"bandwidth"`
+	Metrics      Metrics      `yaml:"metrics"`
 }
 
@@ -2,7 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -35,13 +40,103 @@ func validate(config *Config) error {
 		return fmt.Errorf("at least one route must be configured")
 	}
 
+	names := make(map[string]int)
 	for i, route := range config.Routes {
 		if route.Path == "" {
 			return fmt.Errorf("route[%d]: path cannot be empty", i)
 		}
-		if route.Target == "" {
+		if j, ok := names[route.Name]; ok && route.Name != "" {
+			return fmt.Errorf("route[%d]: name %q is already used by route[%d]", i, route.Name, j)
+		}
+		names[route.Name] = i
+		if err := validateRoutePath(route); err != nil {
+			return fmt.Errorf("route[%d]: %w", i, err)
+		}
+		if route.Target == "" && len(route.Targets) == 0 {
 			return fmt.Errorf("route[%d]: target cannot be empty", i)
 		}
+		if route.Target != "" && len(route.Targets) > 0 {
+			return fmt.Errorf("route[%d]: cannot specify both target and targets, choose one", i)
+		}
+		for j, target := range route.Targets {
+			if target.URL == "" {
+				return fmt.Errorf("route[%d]: targets[%d] url cannot be empty", i, j)
+			}
+			if target.Weight < 0 {
+				return fmt.Errorf("route[%d]: targets[%d] weight cannot be negative", i, j)
+			}
+		}
+		if strategy := route.LoadBalancing.Strategy; strategy != "" && !supportedStrategies[strategy] {
+			return fmt.Errorf("route[%d]: unsupported load_balancing strategy %q", i, strategy)
+		}
+		if route.LoadBalancing.Decay < 0 {
+			return fmt.Errorf("route[%d]: load_balancing decay cannot be negative", i)
+		}
+		if err := validateHashKey(route.LoadBalancing.HashKey); err != nil {
+			return fmt.Errorf("route[%d]: load_balancing %w", i, err)
+		}
+		if lb := route.LoadBalancing.BoundedLoad; lb != 0 && lb <= 1 {
+			return fmt.Errorf("route[%d]: load_balancing bounded_load must be greater than 1", i)
+		}
+		if err := validateRouteMatch(route); err != nil {
+			return fmt.Errorf("route[%d]: %w", i, err)
+		}
+		if err := validatePathRewrite(route); err != nil {
+			return fmt.Errorf("route[%d]: %w", i, err)
+		}
+		if route.RequestHeaders != nil {
+			if err := validateHeaderRules(route.RequestHeaders); err != nil {
+				return fmt.Errorf("route[%d]: request_headers: %w", i, err)
+			}
+		}
+		if route.ResponseHeaders != nil {
+			if err := validateHeaderRules(route.ResponseHeaders); err != nil {
+				return fmt.Errorf("route[%d]: response_headers: %w", i, err)
+			}
+		}
+		if route.StickySession != nil {
+			if err := validateStickySession(route.StickySession); err != nil {
+				return fmt.Errorf("route[%d]: sticky_session: %w", i, err)
+			}
+		}
+		if route.HealthCheck != nil {
+			if err := validateHealthCheck(route.HealthCheck); err != nil {
+				return fmt.Errorf("route[%d]: health_check: %w", i, err)
+			}
+		}
+		if route.OutlierDetection != nil {
+			if err := validateOutlierDetection(route.OutlierDetection); err != nil {
+				return fmt.Errorf("route[%d]: outlier_detection: %w", i, err)
+			}
+		}
+		if route.CircuitBreaker != nil {
+			if err := validateCircuitBreaker(route.CircuitBreaker); err != nil {
+				return fmt.Errorf("route[%d]: circuit_breaker: %w", i, err)
+			}
+		}
+		if route.Retry != nil {
+			if err := validateRetry(route.Retry); err != nil {
+				return fmt.Errorf("route[%d]: retry: %w", i, err)
+			}
+		}
+		if route.Hedging != nil {
+			if err := validateHedging(route.Hedging); err != nil {
+				return fmt.Errorf("route[%d]: hedging: %w", i, err)
+			}
+		}
+		if route.WebSocket != nil {
+			if err := validateWebSocket(route.WebSocket); err != nil {
+				return fmt.Errorf("route[%d]: websocket: %w", i, err)
+			}
+		}
+		if err := validateTransport(&route.Transport); err != nil {
+			return fmt.Errorf("route[%d]: transport: %w", i, err)
+		}
+		if route.Bandwidth != nil {
+			if err := validateBandwidth(route.Bandwidth); err != nil {
+				return fmt.Errorf("route[%d]: bandwidth: %w", i, err)
+			}
+		}
 	}
 
 	if config.RateLimit.RequestsPerSecond <= 0 && config.RateLimit.RequestsPerMinute <= 0 {
@@ -56,12 +151,674 @@ func validate(config *Config) error {
 		return fmt.Errorf("burst must be greater than 0")
 	}
 
+	if err := validateServer(&config.Server); err != nil {
+		return err
+	}
+
+	if err := validateTrustedProxies(&config.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted_proxies: %w", err)
+	}
+
+	if err := validateProxyProtocol(&config.Server.ProxyProtocol); err != nil {
+		return fmt.Errorf("proxy_protocol: %w", err)
+	}
+
+	if err := validateLoadShedding(&config.LoadShedding); err != nil {
+		return fmt.Errorf("load_shedding: %w", err)
+	}
+
+	if err := validateBandwidth(&config.Bandwidth); err != nil {
+		return fmt.Errorf("bandwidth: %w", err)
+	}
+
+	if path := config.Metrics.Path; path != "" && !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("metrics: path must start with /")
+	}
+
+	return nil
+}
+
+func validateServer(server *ServerConfig) error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_header_timeout", server.ReadHeaderTimeout},
+		{"read_timeout", server.ReadTimeout},
+		{"write_timeout", server.WriteTimeout},
+		{"idle_timeout", server.IdleTimeout},
+		{"body_rate_grace", server.BodyRateGrace},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			return fmt.Errorf("server.%s cannot be negative", timeout.name)
+		}
+	}
+
+	if server.MaxHeaderBytes < 0 {
+		return fmt.Errorf("server.max_header_bytes cannot be negative")
+	}
+	if server.MaxConnsPerIP < 0 {
+		return fmt.Errorf("server.max_conns_per_ip cannot be negative")
+	}
+	if server.MinBodyRate < 0 {
+		return fmt.Errorf("server.min_body_rate cannot be negative")
+	}
+
+	return nil
+}
+
+var supportedStrategies = map[string]bool{
+	"round_robin": true,
+	"least_conn":  true,
+	"p2c":         true,
+	"ewma":        true,
+	"ring_hash":   true,
+	"maglev":      true,
+}
+
+var supportedClientIPHeaders = map[string]bool{
+	"X-Forwarded-For":  true,
+	"X-Real-Ip":        true,
+	"Forwarded":        true,
+	"Cf-Connecting-Ip": true,
+}
+
+func validateTrustedProxies(tp *TrustedProxies) error {
+	for _, cidr := range tp.CIDRs {
+		if _, err := ParseNetwork(cidr); err != nil {
+			return err
+		}
+	}
+
+	for _, header := range tp.Headers {
+		if !supportedClientIPHeaders[http.CanonicalHeaderKey(header)] {
+			return fmt.Errorf("unsupported header %q", header)
+		}
+	}
+
+	if tp.Hops < 0 {
+		return fmt.Errorf("hops cannot be negative")
+	}
+
+	switch tp.ForwardedHeaders {
+	case "", "append", "overwrite":
+	default:
+		return fmt.Errorf("unsupported forwarded_headers mode %q (supported: append, overwrite)", tp.ForwardedHeaders)
+	}
+
+	return nil
+}
+
+func validateProxyProtocol(pp *ProxyProtocol) error {
+	if !pp.Enabled {
+		return nil
+	}
+
+	if len(pp.AllowedCIDRs) == 0 {
+		return fmt.Errorf("allowed_cidrs must list the load balancer networks")
+	}
+
+	for _, cidr := range pp.AllowedCIDRs {
+		if _, err := ParseNetwork(cidr); err != nil {
+			return err
+		}
+	}
+
+	if pp.HeaderTimeout < 0 {
+		return fmt.Errorf("header_timeout cannot be negative")
+	}
+
+	return nil
+}
+
+func validateLoadShedding(ls *LoadShedding) error {
+	if !ls.Enabled {
+		return nil
+	}
+
+	if ls.MaxInFlight <= 0 {
+		return fmt.Errorf("max_in_flight must be greater than 0")
+	}
+	if ls.MaxQueue < 0 {
+		return fmt.Errorf("max_queue cannot be negative")
+	}
+	if ls.QueueTimeout < 0 {
+		return fmt.Errorf("queue_timeout cannot be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, class := range ls.Classes {
+		if class.Name == "" {
+			return fmt.Errorf("classes[%d]: name cannot be empty", i)
+		}
+		if names[class.Name] {
+			return fmt.Errorf("classes[%d]: duplicate class %q", i, class.Name)
+		}
+		names[class.Name] = true
+
+		if !class.Exempt && (class.ShedAt <= 0 || class.ShedAt > 1) {
+			return fmt.Errorf("classes[%d]: shed_at must be in (0, 1]", i)
+		}
+	}
+
+	if ls.DefaultClass != "" && !names[ls.DefaultClass] {
+		return fmt.Errorf("default_class %q is not a configured class", ls.DefaultClass)
+	}
+
+	return nil
+}
+
+func validateHashKey(key string) error {
+	switch {
+	case key == "", key == "client_ip", key == "path":
+		return nil
+	case strings.HasPrefix(key, "header:") && len(key) > len("header:"):
+		return nil
+	case strings.HasPrefix(key, "cookie:") && len(key) > len("cookie:"):
+		return nil
+	}
+	return fmt.Errorf("unsupported hash_key %q", key)
+}
+
+func validatePathRewrite(route Route) error {
+	if route.StripPrefix != "" && !strings.HasPrefix(route.StripPrefix, "/") {
+		return fmt.Errorf("strip_prefix must start with /")
+	}
+	if route.AddPrefix != "" && !strings.HasPrefix(route.AddPrefix, "/") {
+		return fmt.Errorf("add_prefix must start with /")
+	}
+	if route.Rewrite != nil {
+		if route.Rewrite.Regex == "" {
+			if route.Match == "regex" || route.Match == "glob" {
+				return nil
+			}
+			return fmt.Errorf("rewrite.regex is required")
+		}
+		if _, err := regexp.Compile(route.Rewrite.Regex); err != nil {
+			return fmt.Errorf("rewrite.regex: %w", err)
+		}
+	}
+	return nil
+}
+
+/*
+validateRoutePath checks the path of a route against its match type. Prefix
+paths may hold ":name" parameters and a "*name" wildcard, which must make up
+a whole segment, the wildcard being the last one.
+*/
+func validateRoutePath(route Route) error {
+	path := route.Path
+	switch route.Match {
+	case "", "prefix":
+	case "regex":
+		if _, err := regexp.Compile(path); err != nil {
+			return fmt.Errorf("path: %w", err)
+		}
+		return nil
+	case "glob":
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("glob path must start with /")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported match type %q (supported: prefix, regex, glob)", route.Match)
+	}
+
+	// ':' and '*' are literal unless they start a segment
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		name := segment[1:]
+		if name == "" || strings.ContainsAny(name, ":*") {
+			return fmt.Errorf("path %s: invalid parameter %q", path, segment)
+		}
+		if segment[0] == '*' && i != len(segments)-1 {
+			return fmt.Errorf("path %s: wildcard %s must be the last segment", path, segment)
+		}
+	}
+	return nil
+}
+
+func validateRouteMatch(route Route) error {
+	for _, host := range route.Hosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "*/ ") {
+			return fmt.Errorf("invalid host %q", host)
+		}
+	}
+	for _, method := range route.Methods {
+		if method == "" || strings.ToUpper(method) != method {
+			return fmt.Errorf("invalid method %q, methods must be upper case", method)
+		}
+	}
+	for name := range route.Headers {
+		if name == "" {
+			return fmt.Errorf("header name cannot be empty")
+		}
+	}
+	for name := range route.Query {
+		if name == "" {
+			return fmt.Errorf("query parameter name cannot be empty")
+		}
+	}
+	for _, cidr := range route.SourceCIDRs {
+		if _, err := ParseNetwork(cidr); err != nil {
+			return fmt.Errorf("source_cidrs: %w", err)
+		}
+	}
+	return nil
+}
+
+var headerVariables = map[string]bool{
+	"client_ip":  true,
+	"route":      true,
+	"path":       true,
+	"request_id": true,
+	"method":     true,
+	"host":       true,
+	"upstream":   true,
+}
+
+/*
+KnownHeaderVariable accepts the fixed header variables and {param.<name>},
+which refers to a path parameter of the matched route.
+*/
+func KnownHeaderVariable(name string) bool {
+	if param, ok := strings.CutPrefix(name, "param."); ok {
+		return param != ""
+	}
+	return headerVariables[name]
+}
+
+// HeaderVariable matches a {variable} reference in a header value.
+var HeaderVariable = regexp.MustCompile(`\{([^{}]*)\}`)
+
+func validateHeaderRules(rules *HeaderRules) error {
+	for _, values := range []map[string]string{rules.Set, rules.Add} {
+		for name, value := range values {
+			if name == "" {
+				return fmt.Errorf("header name cannot be empty")
+			}
+			for _, match := range HeaderVariable.FindAllStringSubmatch(value, -1) {
+				if !KnownHeaderVariable(match[1]) {
+					return fmt.Errorf("header %s: unknown variable {%s}", name, match[1])
+				}
+			}
+		}
+	}
+	for _, name := range rules.Remove {
+		if name == "" {
+			return fmt.Errorf("header name cannot be empty")
+		}
+	}
+	for from, to := range rules.Rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("header name cannot be empty")
+		}
+	}
+	return nil
+}
+
+func validateStickySession(ss *StickySession) error {
+	if ss.TTL < 0 {
+		return fmt.Errorf("ttl cannot be negative")
+	}
+
+	switch strings.ToLower(ss.SameSite) {
+	case "", "lax", "strict", "none":
+	default:
+		return fmt.Errorf("same_site must be lax, strict or none")
+	}
+
+	if strings.EqualFold(ss.SameSite, "none") && !ss.Secure {
+		return fmt.Errorf("same_site none requires secure")
+	}
+
+	return nil
+}
+
+func validateHealthCheck(hc *HealthCheck) error {
+	if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if hc.Interval < 0 || hc.Timeout < 0 {
+		return fmt.Errorf("interval and timeout cannot be negative")
+	}
+	if hc.Interval > 0 && hc.Timeout > hc.Interval {
+		return fmt.Errorf("timeout cannot exceed interval")
+	}
+	if hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+		return fmt.Errorf("thresholds cannot be negative")
+	}
+	for _, status := range hc.ExpectedStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid expected status %d", status)
+		}
+	}
+	return nil
+}
+
+func validateOutlierDetection(od *OutlierDetection) error {
+	if od.Consecutive5xx < 0 {
+		return fmt.Errorf("consecutive_5xx cannot be negative")
+	}
+	if od.BaseEjectionTime < 0 || od.MaxEjectionTime < 0 {
+		return fmt.Errorf("ejection times cannot be negative")
+	}
+	if od.MaxEjectionTime > 0 && od.MaxEjectionTime < od.BaseEjectionTime {
+		return fmt.Errorf("max_ejection_time cannot be less than base_ejection_time")
+	}
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		return fmt.Errorf("max_ejection_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+func validateCircuitBreaker(cb *CircuitBreaker) error {
+	if cb.ErrorRatio < 0 || cb.ErrorRatio > 1 {
+		return fmt.Errorf("error_ratio must be between 0 and 1")
+	}
+	if cb.MinRequests < 0 || cb.HalfOpenRequests < 0 {
+		return fmt.Errorf("request counts cannot be negative")
+	}
+	if cb.Window < 0 || cb.OpenDuration < 0 {
+		return fmt.Errorf("window and open_duration cannot be negative")
+	}
+	return nil
+}
+
+var supportedRetryConditions = map[string]bool{
+	"connect_failure": true,
+	"timeout":         true,
+	"error":           true,
+	"gateway_error":   true,
+	"5xx":             true,
+}
+
+func validateRetry(r *Retry) error {
+	if r.Attempts < 0 {
+		return fmt.Errorf("attempts cannot be negative")
+	}
+	if r.PerTryTimeout < 0 || r.Backoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("timeouts and backoff cannot be negative")
+	}
+	if r.MaxBackoff > 0 && r.MaxBackoff < r.Backoff {
+		return fmt.Errorf("max_backoff cannot be less than backoff")
+	}
+	for _, condition := range r.RetryOn {
+		if !supportedRetryConditions[condition] {
+			return fmt.Errorf("unsupported retry_on condition %q", condition)
+		}
+	}
+	for _, status := range r.StatusCodes {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid status code %d", status)
+		}
+	}
+	if r.BudgetPercent < 0 || r.BudgetPercent > 100 {
+		return fmt.Errorf("budget_percent must be between 0 and 100")
+	}
+	if r.MinRetriesPerSecond < 0 || r.MaxBodySize < 0 {
+		return fmt.Errorf("min_retries_per_second and max_body_size cannot be negative")
+	}
+	return nil
+}
+
+func validateHedging(h *Hedging) error {
+	if h.Percentile < 0 || h.Percentile >= 100 {
+		return fmt.Errorf("percentile must be between 0 and 100")
+	}
+	if h.MinDelay < 0 {
+		return fmt.Errorf("min_delay cannot be negative")
+	}
+	if h.MaxHedges < 0 {
+		return fmt.Errorf("max_hedges cannot be negative")
+	}
+	return nil
+}
+
+func validateWebSocket(ws *WebSocket) error {
+	if ws.MaxConnectionsPerClient < 0 {
+		return fmt.Errorf("max_connections_per_client cannot be negative")
+	}
+	if ws.MessageRate < 0 {
+		return fmt.Errorf("message_rate cannot be negative")
+	}
+	if ws.MessageBurst < 0 {
+		return fmt.Errorf("message_burst cannot be negative")
+	}
+	return nil
+}
+
+func validateTransport(t *Transport) error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"dial_timeout", t.DialTimeout},
+		{"tls_handshake_timeout", t.TLSHandshakeTimeout},
+		{"response_header_timeout", t.ResponseHeaderTimeout},
+		{"request_timeout", t.RequestTimeout},
+		{"idle_conn_timeout", t.IdleConnTimeout},
+		{"keep_alive", t.KeepAlive},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			return fmt.Errorf("%s cannot be negative", timeout.name)
+		}
+	}
+	if t.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns_per_host cannot be negative")
+	}
 	return nil
 }
 
+func validateBandwidth(bw *Bandwidth) error {
+	if bw.Upload < 0 || bw.Download < 0 {
+		return fmt.Errorf("rates cannot be negative")
+	}
+	return nil
+}
+
+/*
+ParseNetwork parses a CIDR block or a bare IP address. A bare address is
+returned as a single-host network.
+*/
+func ParseNetwork(cidr string) (*net.IPNet, error) {
+	if strings.Contains(cidr, "/") {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(cidr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", cidr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
 
 func setDefaults(config *Config) {
 	if config.Server.Port == 0 {
 		config.Server.Port = 8080
 	}
-}
\ No newline at end of file
+	if config.Server.ReadHeaderTimeout == 0 {
+		config.Server.ReadHeaderTimeout = 10 * time.Second
+	}
+	if config.Server.IdleTimeout == 0 {
+		config.Server.IdleTimeout = 120 * time.Second
+	}
+	if config.Server.MaxHeaderBytes == 0 {
+		config.Server.MaxHeaderBytes = 1 << 20
+	}
+	if config.Server.MinBodyRate > 0 && config.Server.BodyRateGrace == 0 {
+		config.Server.BodyRateGrace = 5 * time.Second
+	}
+
+	tp := &config.Server.TrustedProxies
+	if len(tp.CIDRs) > 0 && len(tp.Headers) == 0 {
+		tp.Headers = []string{"X-Forwarded-For"}
+	}
+	for i, header := range tp.Headers {
+		tp.Headers[i] = http.CanonicalHeaderKey(header)
+	}
+	if tp.ForwardedHeaders == "" {
+		tp.ForwardedHeaders = "append"
+	}
+
+	if config.Server.ProxyProtocol.Enabled && config.Server.ProxyProtocol.HeaderTimeout == 0 {
+		config.Server.ProxyProtocol.HeaderTimeout = 5 * time.Second
+	}
+
+	if config.Metrics.Enabled && config.Metrics.Path == "" {
+		config.Metrics.Path = "/metrics"
+	}
+
+	if config.LoadShedding.APIKeyHeader == "" {
+		config.LoadShedding.APIKeyHeader = "X-API-Key"
+	}
+
+	for i := range config.Routes {
+		if config.Routes[i].Match == "" {
+			config.Routes[i].Match = "prefix"
+		}
+		if config.Routes[i].LoadBalancing.Strategy == "" {
+			config.Routes[i].LoadBalancing.Strategy = "round_robin"
+		}
+		if config.Routes[i].LoadBalancing.Decay == 0 {
+			config.Routes[i].LoadBalancing.Decay = 10 * time.Second
+		}
+		if config.Routes[i].LoadBalancing.HashKey == "" {
+			config.Routes[i].LoadBalancing.HashKey = "client_ip"
+		}
+		if ss := config.Routes[i].StickySession; ss != nil {
+			// One cookie per route, or routes would overwrite each other's
+			// affinity as clients move between them
+			if ss.CookieName == "" {
+				ss.CookieName = fmt.Sprintf("gothrottle_affinity_%d", i)
+			}
+			if ss.Path == "" {
+				ss.Path = "/"
+			}
+			if ss.HTTPOnly == nil {
+				httpOnly := true
+				ss.HTTPOnly = &httpOnly
+			}
+		}
+		if hc := config.Routes[i].HealthCheck; hc != nil {
+			if hc.Path == "" {
+				hc.Path = "/health"
+			}
+			if hc.Interval == 0 {
+				hc.Interval = 10 * time.Second
+			}
+			if hc.Timeout == 0 {
+				hc.Timeout = min(2*time.Second, hc.Interval)
+			}
+			if hc.HealthyThreshold == 0 {
+				hc.HealthyThreshold = 2
+			}
+			if hc.UnhealthyThreshold == 0 {
+				hc.UnhealthyThreshold = 3
+			}
+		}
+		if od := config.Routes[i].OutlierDetection; od != nil {
+			if od.Consecutive5xx == 0 {
+				od.Consecutive5xx = 5
+			}
+			if od.BaseEjectionTime == 0 {
+				od.BaseEjectionTime = 30 * time.Second
+			}
+			if od.MaxEjectionTime == 0 {
+				od.MaxEjectionTime = max(300*time.Second, od.BaseEjectionTime)
+			}
+			if od.MaxEjectionPercent == 0 {
+				od.MaxEjectionPercent = 50
+			}
+		}
+		if cb := config.Routes[i].CircuitBreaker; cb != nil {
+			if cb.ErrorRatio == 0 {
+				cb.ErrorRatio = 0.5
+			}
+			if cb.MinRequests == 0 {
+				cb.MinRequests = 20
+			}
+			if cb.Window == 0 {
+				cb.Window = 10 * time.Second
+			}
+			if cb.OpenDuration == 0 {
+				cb.OpenDuration = 30 * time.Second
+			}
+			if cb.HalfOpenRequests == 0 {
+				cb.HalfOpenRequests = 3
+			}
+		}
+		if r := config.Routes[i].Retry; r != nil {
+			if r.Attempts == 0 {
+				r.Attempts = 2
+			}
+			if r.Backoff == 0 {
+				r.Backoff = 25 * time.Millisecond
+			}
+			if r.MaxBackoff == 0 {
+				r.MaxBackoff = max(250*time.Millisecond, r.Backoff)
+			}
+			if len(r.RetryOn) == 0 && len(r.StatusCodes) == 0 {
+				r.RetryOn = []string{"connect_failure", "gateway_error"}
+			}
+			if r.BudgetPercent == 0 {
+				r.BudgetPercent = 20
+			}
+			if r.MinRetriesPerSecond == 0 {
+				r.MinRetriesPerSecond = 3
+			}
+			if r.MaxBodySize == 0 {
+				r.MaxBodySize = 64 << 10
+			}
+		}
+		if h := config.Routes[i].Hedging; h != nil {
+			if h.Percentile == 0 {
+				h.Percentile = 95
+			}
+			if h.MinDelay == 0 {
+				h.MinDelay = 10 * time.Millisecond
+			}
+			if h.MaxHedges == 0 {
+				h.MaxHedges = 1
+			}
+		}
+		if ws := config.Routes[i].WebSocket; ws != nil && ws.MessageRate > 0 && ws.MessageBurst == 0 {
+			ws.MessageBurst = max(1, int(ws.MessageRate))
+		}
+		setTransportDefaults(&config.Routes[i].Transport)
+	}
+}
+
+func setTransportDefaults(t *Transport) {
+	if t.DialTimeout == 0 {
+		t.DialTimeout = 5 * time.Second
+	}
+	if t.TLSHandshakeTimeout == 0 {
+		t.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if t.ResponseHeaderTimeout == 0 {
+		t.ResponseHeaderTimeout = 30 * time.Second
+	}
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = 32
+	}
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = 90 * time.Second
+	}
+	if t.KeepAlive == 0 {
+		t.KeepAlive = 30 * time.Second
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -118,6 +119,819 @@ rate_limit:
 routes:
   - path: ""
     target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "valid trusted proxies",
+			config: `
+server:
+  trusted_proxies:
+    cidrs: ["10.0.0.0/8", "192.168.1.10"]
+    headers: ["X-Forwarded-For", "CF-Connecting-IP"]
+    hops: 1
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: false,
+		},
+		{
+			name: "invalid trusted proxy CIDR",
+			config: `
+server:
+  trusted_proxies:
+    cidrs: ["10.0.0.0/40"]
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "proxy protocol without allowed CIDRs",
+			config: `
+server:
+  proxy_protocol:
+    enabled: true
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "load shedding with unknown default class",
+			config: `
+load_shedding:
+  enabled: true
+  max_in_flight: 100
+  default_class: standard
+  classes:
+    - name: critical
+      paths: ["/ping"]
+      exempt: true
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "load shedding class share out of range",
+			config: `
+load_shedding:
+  enabled: true
+  max_in_flight: 100
+  classes:
+    - name: bulk
+      shed_at: 1.5
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "multiple targets",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets:
+      - "http://localhost:8000"
+      - url: "http://localhost:8001"
+        weight: 3
+`,
+			expectError: false,
+		},
+		{
+			name: "target and targets together",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    targets: ["http://localhost:8001"]
+`,
+			expectError: true,
+		},
+		{
+			name: "negative target weight",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets:
+      - url: "http://localhost:8001"
+        weight: -1
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported load balancing strategy",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    load_balancing:
+      strategy: random
+`,
+			expectError: true,
+		},
+		{
+			name: "consistent hash balancing",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets: ["http://localhost:8000", "http://localhost:8001"]
+    load_balancing:
+      strategy: maglev
+      hash_key: "cookie:session"
+      bounded_load: 1.25
+`,
+			expectError: false,
+		},
+		{
+			name: "unsupported hash key",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    load_balancing:
+      strategy: ring_hash
+      hash_key: "query:user"
+`,
+			expectError: true,
+		},
+		{
+			name: "sticky session",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/app"
+    targets: ["http://localhost:8000", "http://localhost:8001"]
+    sticky_session:
+      secret: "s3cret"
+      ttl: 1h
+      same_site: strict
+`,
+			expectError: false,
+		},
+		{
+			name: "sticky session same_site none without secure",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/app"
+    target: "http://localhost:8000"
+    sticky_session:
+      same_site: none
+`,
+			expectError: true,
+		},
+		{
+			name: "sticky session invalid same_site",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/app"
+    target: "http://localhost:8000"
+    sticky_session:
+      same_site: sometimes
+`,
+			expectError: true,
+		},
+		{
+			name: "health check",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    health_check:
+      path: "/healthz"
+      interval: 5s
+      timeout: 1s
+      expected_status: [200, 204]
+`,
+			expectError: false,
+		},
+		{
+			name: "health check timeout exceeds interval",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    health_check:
+      interval: 1s
+      timeout: 5s
+`,
+			expectError: true,
+		},
+		{
+			name: "health check invalid expected status",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    health_check:
+      expected_status: [42]
+`,
+			expectError: true,
+		},
+		{
+			name: "outlier detection",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets: ["http://localhost:8000", "http://localhost:8001"]
+    outlier_detection:
+      consecutive_5xx: 3
+      base_ejection_time: 10s
+      max_ejection_time: 2m
+      max_ejection_percent: 50
+`,
+			expectError: false,
+		},
+		{
+			name: "outlier detection percent out of range",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    outlier_detection:
+      max_ejection_percent: 150
+`,
+			expectError: true,
+		},
+		{
+			name: "outlier detection max below base",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    outlier_detection:
+      base_ejection_time: 1m
+      max_ejection_time: 10s
+`,
+			expectError: true,
+		},
+		{
+			name: "circuit breaker",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    circuit_breaker:
+      error_ratio: 0.25
+      min_requests: 50
+      window: 30s
+      open_duration: 15s
+      half_open_requests: 5
+`,
+			expectError: false,
+		},
+		{
+			name: "circuit breaker error ratio above 1",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    circuit_breaker:
+      error_ratio: 1.5
+`,
+			expectError: true,
+		},
+		{
+			name: "retry",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets: ["http://localhost:8000", "http://localhost:8001"]
+    retry:
+      attempts: 3
+      per_try_timeout: 2s
+      backoff: 50ms
+      max_backoff: 1s
+      retry_on: [connect_failure, 5xx]
+      status_codes: [429]
+      budget_percent: 10
+      max_body_size: 1MiB
+`,
+			expectError: false,
+		},
+		{
+			name: "retry unsupported condition",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    retry:
+      retry_on: [always]
+`,
+			expectError: true,
+		},
+		{
+			name: "retry budget above 100 percent",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    retry:
+      budget_percent: 150
+`,
+			expectError: true,
+		},
+		{
+			name: "hedging",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets: ["http://localhost:8000", "http://localhost:8001"]
+    hedging:
+      percentile: 99
+      min_delay: 5ms
+      max_hedges: 2
+`,
+			expectError: false,
+		},
+		{
+			name: "hedging percentile out of range",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    hedging:
+      percentile: 100
+`,
+			expectError: true,
+		},
+		{
+			name: "transport tuning",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    transport:
+      dial_timeout: 2s
+      response_header_timeout: 5s
+      request_timeout: 30s
+      max_idle_conns_per_host: 100
+      disable_keep_alives: true
+`,
+			expectError: false,
+		},
+		{
+			name: "negative transport timeout",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    transport:
+      dial_timeout: -1s
+`,
+			expectError: true,
+		},
+		{
+			name: "path rewriting",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    strip_prefix: "/api"
+    add_prefix: "/v1"
+    rewrite:
+      regex: "^/users/(\\d+)$"
+      replacement: "/accounts/$1"
+`,
+			expectError: false,
+		},
+		{
+			name: "invalid rewrite regex",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    rewrite:
+      regex: "^/users/(\\d+$"
+      replacement: "/accounts/$1"
+`,
+			expectError: true,
+		},
+		{
+			name: "strip prefix without leading slash",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    strip_prefix: "api"
+`,
+			expectError: true,
+		},
+		{
+			name: "header rules",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - name: "users"
+    path: "/api"
+    target: "http://localhost:8000"
+    request_headers:
+      set:
+        X-Request-ID: "{request_id}"
+        X-Client: "{client_ip} on {route}"
+      rename:
+        X-Token: Authorization
+    response_headers:
+      remove: ["Server", "X-Powered-By"]
+`,
+			expectError: false,
+		},
+		{
+			name: "unknown header variable",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    request_headers:
+      add:
+        X-User: "{user}"
+`,
+			expectError: true,
+		},
+		{
+			name: "empty header name",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    response_headers:
+      remove: [""]
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported forwarded headers mode",
+			config: `
+server:
+  trusted_proxies:
+    cidrs: ["10.0.0.0/8"]
+    forwarded_headers: "strip"
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "host and header routing",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/"
+    target: "http://localhost:8000"
+    hosts: ["api.example.com", "*.api.example.com"]
+    methods: ["GET", "POST"]
+    headers:
+      X-Api-Version: "2"
+    query:
+      preview: "*"
+    source_cidrs: ["10.0.0.0/8", "192.168.1.1"]
+`,
+			expectError: false,
+		},
+		{
+			name: "invalid wildcard host",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/"
+    target: "http://localhost:8000"
+    hosts: ["api.*.com"]
+`,
+			expectError: true,
+		},
+		{
+			name: "lower case method",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/"
+    target: "http://localhost:8000"
+    methods: ["get"]
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid source CIDR",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/"
+    target: "http://localhost:8000"
+    source_cidrs: ["10.0.0.0/40"]
+`,
+			expectError: true,
+		},
+		{
+			name: "path parameters",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/users/:id/posts"
+    target: "http://localhost:8000"
+    request_headers:
+      set:
+        X-User-ID: "{param.id}"
+  - path: "/files/*rest"
+    target: "http://localhost:9000"
+`,
+			expectError: false,
+		},
+		{
+			name: "literal colon inside segment",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/v1/items:batch"
+    target: "http://localhost:8000"
+  - path: "/files/a*b"
+    target: "http://localhost:8000"
+`,
+			expectError: false,
+		},
+		{
+			name: "wildcard before last segment",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/files/*rest/meta"
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "regex and glob routes",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "^/v[0-9]+/legacy/(?P<page>.*)\\.php$"
+    match: regex
+    target: "http://localhost:8000"
+    rewrite:
+      replacement: "/legacy/${page}"
+  - path: "/assets/**.css"
+    match: glob
+    target: "http://localhost:9000"
+`,
+			expectError: false,
+		},
+		{
+			name: "invalid route regex",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "^/v[0-9+/legacy"
+    match: regex
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported match type",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    match: exact
+    target: "http://localhost:8000"
+`,
+			expectError: true,
+		},
+		{
+			name: "rewrite without regex on prefix route",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+    rewrite:
+      replacement: "/v1"
+`,
+			expectError: true,
+		},
+		{
+			name: "websocket limits",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/ws"
+    target: "http://localhost:8000"
+    websocket:
+      max_connections_per_client: 5
+      message_rate: 20
+`,
+			expectError: false,
+		},
+		{
+			name: "streaming route",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/events"
+    target: "http://localhost:8000"
+    flush_interval: -1ms
+    streaming: true
+    transport:
+      request_timeout: 30s
+`,
+			expectError: false,
+		},
+		{
+			name: "negative websocket message rate",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/ws"
+    target: "http://localhost:8000"
+    websocket:
+      message_rate: -1
+`,
+			expectError: true,
+		},
+		{
+			name: "duplicate route names",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - name: "api"
+    path: "/api"
+    target: "http://localhost:8000"
+  - name: "api"
+    path: "/v2"
+    target: "http://localhost:8001"
+`,
+			expectError: true,
+		},
+		{
+			name: "relative metrics path",
+			config: `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+metrics:
+  enabled: true
+  path: "metrics"
+`,
+			expectError: true,
+		},
+		{
+			name: "unsupported client IP header",
+			config: `
+server:
+  trusted_proxies:
+    cidrs: ["10.0.0.0/8"]
+    headers: ["X-Client-IP"]
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
 `,
 			expectError: true,
 		},
@@ -178,4 +992,207 @@ routes:
 	if cfg.Server.Port != 8080 {
 		t.Errorf("Expected default port 8080, got %d", cfg.Server.Port)
 	}
+
+	if cfg.Server.ReadHeaderTimeout != 10*time.Second {
+		t.Errorf("Expected default read_header_timeout 10s, got %v", cfg.Server.ReadHeaderTimeout)
+	}
+
+	if cfg.Server.MaxHeaderBytes != 1<<20 {
+		t.Errorf("Expected default max_header_bytes 1MiB, got %d", cfg.Server.MaxHeaderBytes)
+	}
+
+	if cfg.Routes[0].LoadBalancing.Strategy != "round_robin" {
+		t.Errorf("Expected default strategy round_robin, got %s", cfg.Routes[0].LoadBalancing.Strategy)
+	}
+
+	if len(cfg.Server.TrustedProxies.Headers) != 0 {
+		t.Errorf("Expected no client IP headers without trusted proxies, got %v", cfg.Server.TrustedProxies.Headers)
+	}
+}
+
+func TestUpstreamWeights(t *testing.T) {
+	config := `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/api"
+    targets:
+      - "http://localhost:8000"
+      - url: "http://localhost:8001"
+        weight: 3
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	cfg, err := Load(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	upstreams := cfg.Routes[0].Upstreams()
+	if len(upstreams) != 2 {
+		t.Fatalf("Expected 2 upstreams, got %d", len(upstreams))
+	}
+	if upstreams[0].URL != "http://localhost:8000" || upstreams[0].Weight != 1 {
+		t.Errorf("Expected plain URL with default weight 1, got %+v", upstreams[0])
+	}
+	if upstreams[1].URL != "http://localhost:8001" || upstreams[1].Weight != 3 {
+		t.Errorf("Expected weighted upstream, got %+v", upstreams[1])
+	}
+}
+
+func TestBandwidthDefaults(t *testing.T) {
+	config := `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+bandwidth:
+  upload: 1MiB/s
+  download: 5MiB/s
+routes:
+  - path: "/api"
+    target: "http://localhost:8000"
+  - path: "/api/export"
+    target: "http://localhost:8000"
+    bandwidth:
+      download: 512KiB/s
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	cfg, err := Load(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Routes without a block share the global limit rather than copying it
+	if bw := cfg.Routes[0].Bandwidth; bw != nil {
+		t.Errorf("Expected route to use the shared global bandwidth, got %+v", bw)
+	}
+	if cfg.Bandwidth.Upload != 1<<20 || cfg.Bandwidth.Download != 5<<20 {
+		t.Errorf("Expected global bandwidth 1MiB/s up and 5MiB/s down, got %+v", cfg.Bandwidth)
+	}
+
+	if bw := cfg.Routes[1].Bandwidth; bw == nil || bw.Upload != 0 || bw.Download != 512<<10 {
+		t.Errorf("Expected route override to be kept as-is, got %+v", bw)
+	}
+}
+
+func TestRouteFeatureDefaults(t *testing.T) {
+	config := `
+rate_limit:
+  requests_per_second: 10
+  burst: 50
+routes:
+  - path: "/app"
+    target: "http://localhost:8000"
+    sticky_session:
+      ttl: 30m
+    health_check: {}
+    outlier_detection: {}
+    circuit_breaker: {}
+    retry:
+      max_body_size: 128KiB
+    hedging: {}
+metrics:
+  enabled: true
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	cfg, err := Load(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Routes[0].Match != "prefix" {
+		t.Errorf("Expected default match type prefix, got %s", cfg.Routes[0].Match)
+	}
+	if cfg.Metrics.Path != "/metrics" {
+		t.Errorf("Expected default metrics path /metrics, got %s", cfg.Metrics.Path)
+	}
+
+	ss := cfg.Routes[0].StickySession
+	if ss.CookieName != "gothrottle_affinity_0" {
+		t.Errorf("Expected default cookie name gothrottle_affinity_0, got %s", ss.CookieName)
+	}
+	if ss.Path != "/" {
+		t.Errorf("Expected default cookie path /, got %s", ss.Path)
+	}
+	if ss.HTTPOnly == nil || !*ss.HTTPOnly {
+		t.Error("Expected cookie to be HttpOnly by default")
+	}
+	if ss.TTL != 30*time.Minute {
+		t.Errorf("Expected ttl 30m, got %v", ss.TTL)
+	}
+
+	hc := cfg.Routes[0].HealthCheck
+	if hc.Path != "/health" || hc.Interval != 10*time.Second || hc.Timeout != 2*time.Second {
+		t.Errorf("Expected default health check /health every 10s with 2s timeout, got %+v", hc)
+	}
+	if hc.HealthyThreshold != 2 || hc.UnhealthyThreshold != 3 {
+		t.Errorf("Expected default thresholds 2/3, got %d/%d", hc.HealthyThreshold, hc.UnhealthyThreshold)
+	}
+
+	od := cfg.Routes[0].OutlierDetection
+	if od.Consecutive5xx != 5 || od.BaseEjectionTime != 30*time.Second || od.MaxEjectionTime != 300*time.Second || od.MaxEjectionPercent != 50 {
+		t.Errorf("Expected outlier detection defaults 5/30s/300s/50%%, got %+v", od)
+	}
+
+	cb := cfg.Routes[0].CircuitBreaker
+	if cb.ErrorRatio != 0.5 || cb.MinRequests != 20 || cb.Window != 10*time.Second || cb.OpenDuration != 30*time.Second || cb.HalfOpenRequests != 3 {
+		t.Errorf("Expected circuit breaker defaults 0.5/20/10s/30s/3, got %+v", cb)
+	}
+
+	r := cfg.Routes[0].Retry
+	if r.Attempts != 2 || r.Backoff != 25*time.Millisecond || r.MaxBackoff != 250*time.Millisecond {
+		t.Errorf("Expected retry defaults 2 attempts with 25ms-250ms backoff, got %+v", r)
+	}
+	if len(r.RetryOn) != 2 || r.BudgetPercent != 20 || r.MinRetriesPerSecond != 3 {
+		t.Errorf("Expected default retry conditions and budget, got %+v", r)
+	}
+	if r.MaxBodySize != 128<<10 {
+		t.Errorf("Expected max_body_size 128KiB, got %d", r.MaxBodySize)
+	}
+
+	h := cfg.Routes[0].Hedging
+	if h.Percentile != 95 || h.MinDelay != 10*time.Millisecond || h.MaxHedges != 1 {
+		t.Errorf("Expected hedging defaults p95/10ms/1, got %+v", h)
+	}
+
+	tr := cfg.Routes[0].Transport
+	if tr.DialTimeout != 5*time.Second || tr.TLSHandshakeTimeout != 10*time.Second || tr.ResponseHeaderTimeout != 30*time.Second {
+		t.Errorf("Expected default upstream timeouts 5s/10s/30s, got %+v", tr)
+	}
+	if tr.RequestTimeout != 0 {
+		t.Errorf("Expected no default request timeout, got %v", tr.RequestTimeout)
+	}
+	if tr.MaxIdleConnsPerHost != 32 || tr.IdleConnTimeout != 90*time.Second || tr.KeepAlive != 30*time.Second {
+		t.Errorf("Expected default pool settings 32/90s/30s, got %+v", tr)
+	}
 }
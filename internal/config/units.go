@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+}
+
+/*
+ByteRate is a throughput in bytes per second. In YAML it accepts a plain
+number of bytes or a size with a unit and optional "/s" suffix, such as
+"512KiB/s" or "5MB".
+*/
+type ByteRate int64
+
+func (b *ByteRate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case uint64:
+		*b = ByteRate(v)
+		return nil
+	case int64:
+		*b = ByteRate(v)
+		return nil
+	case string:
+		rate, err := ParseByteRate(v)
+		if err != nil {
+			return err
+		}
+		*b = rate
+		return nil
+	default:
+		return fmt.Errorf("invalid byte rate %v", raw)
+	}
+}
+
+/*
+ParseByteRate parses strings such as "1MiB/s", "500KB" or "2048".
+*/
+func ParseByteRate(s string) (ByteRate, error) {
+	value := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+
+	i := 0
+	for i < len(value) && (value[i] >= '0' && value[i] <= '9' || value[i] == '.') {
+		i++
+	}
+
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte rate %q", s)
+	}
+
+	multiplier, ok := byteUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte rate unit in %q", s)
+	}
+
+	return ByteRate(number * float64(multiplier)), nil
+}
+
+/*
+ByteSize is an amount of bytes, written like a ByteRate without the "/s"
+suffix, such as "64KiB".
+*/
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var rate ByteRate
+	if err := rate.UnmarshalYAML(unmarshal); err != nil {
+		return err
+	}
+	*b = ByteSize(rate)
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ByteRate
+		wantErr  bool
+	}{
+		{"1MiB/s", 1 << 20, false},
+		{"5MB/s", 5000000, false},
+		{"512KiB", 512 * 1024, false},
+		{"2048", 2048, false},
+		{"1.5 KB/s", 1500, false},
+		{"10 parsecs", 0, true},
+		{"fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseByteRate(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if rate != tt.expected {
+			t.Errorf("%q: expected %d, got %d", tt.input, tt.expected, rate)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+)
+
+/*
+ClientIP returns a Gin middleware that resolves the real client IP once per
+request and stores it in the request context, where the logger, the rate
+limiter and the proxy handler pick it up. It also records whether incoming
+forwarding headers may be passed on upstream.
+*/
+func ClientIP(resolver *clientip.Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := resolver.Resolve(c.Request)
+		ctx := clientip.WithIP(c.Request.Context(), ip)
+		ctx = clientip.WithForwarding(ctx, resolver.Forwarding(c.Request))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func clientIP(c *gin.Context) string {
+	if ip, ok := clientip.FromContext(c.Request.Context()); ok {
+		return ip
+	}
+	return c.ClientIP()
+}
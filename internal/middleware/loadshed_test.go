@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func newShedderRouter(ls *LoadShedder, block <-chan struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ls.Shed())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	router.GET("/slow", func(c *gin.Context) {
+		<-block
+		c.String(http.StatusOK, "done")
+	})
+	return router
+}
+
+func waitForInFlight(t *testing.T, ls *LoadShedder, n int) {
+	deadline := time.Now().Add(time.Second)
+	for ls.InFlight() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d in-flight requests, got %d", n, ls.InFlight())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadShedderPriorityClasses(t *testing.T) {
+	ls := NewLoadShedder(config.LoadShedding{
+		Enabled:      true,
+		MaxInFlight:  4,
+		APIKeyHeader: "X-API-Key",
+		DefaultClass: "bulk",
+		Classes: []config.PriorityClass{
+			{Name: "health", Paths: []string{"/ping"}, Exempt: true},
+			{Name: "paid", Headers: map[string]string{"X-Tier": "paid"}, APIKeys: []string{"gold-key"}, ShedAt: 1.0},
+			{Name: "bulk", ShedAt: 0.5},
+		},
+	})
+
+	block := make(chan struct{})
+	router := newShedderRouter(ls, block)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		}()
+	}
+	waitForInFlight(t, ls, 2)
+
+	// Bulk traffic is over its half share and must be shed
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected bulk request to be shed with 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on shed request")
+	}
+
+	// Paying customers still get through, by header or API key
+	for _, header := range []struct{ name, value string }{{"X-Tier", "paid"}, {"X-API-Key", "gold-key"}} {
+		wg.Add(1)
+		go func(name, value string) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+			req.Header.Set(name, value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected paid request to be admitted, got %d", w.Code)
+			}
+		}(header.name, header.value)
+	}
+	waitForInFlight(t, ls, 4)
+
+	// Health checks are exempt even at full capacity
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected health check to bypass shedding, got %d", w.Code)
+	}
+
+	close(block)
+	wg.Wait()
+
+	if ls.InFlight() != 0 {
+		t.Errorf("Expected 0 in-flight requests after completion, got %d", ls.InFlight())
+	}
+}
+
+func TestLoadShedderQueue(t *testing.T) {
+	ls := NewLoadShedder(config.LoadShedding{
+		Enabled:      true,
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: time.Second,
+	})
+
+	block := make(chan struct{})
+	router := newShedderRouter(ls, block)
+
+	done := make(chan int, 2)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- w.Code
+	}()
+	waitForInFlight(t, ls, 1)
+
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- w.Code
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for ls.Queued() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected request to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Queue is full, so a third request is rejected immediately
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when queue is full, got %d", w.Code)
+	}
+
+	close(block)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected queued request to complete, got %d", code)
+		}
+	}
+}
@@ -1,30 +1,65 @@
 package middleware
 
 import (
+	"bufio"
 	"log"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+/*
+Logger logs one line per request once it has been served. Hijacked
+connections such as proxied WebSockets are logged when they close, with
+status 101 since their response never passes through the writer. Streamed
+responses are logged when the stream ends, including streams aborted by a
+panic, so the latency covers the whole stream.
+*/
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		method := c.Request.Method
 
+		writer := &hijackRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		defer func() {
+			latency := time.Since(start)
+			statusCode := c.Writer.Status()
+			if writer.hijacked {
+				statusCode = http.StatusSwitchingProtocols
+			}
+			ip := clientIP(c)
+
+			log.Printf("[%s] %s %s %d %v",
+				method,
+				path,
+				ip,
+				statusCode,
+				latency,
+			)
+		}()
+
 		c.Next()
+	}
+}
 
-		latency := time.Since(start)
-		statusCode := c.Writer.Status()
-		clientIP := c.ClientIP()
-
-		log.Printf("[%s] %s %s %d %v",
-			method,
-			path,
-			clientIP,
-			statusCode,
-			latency,
-		)
+type hijackRecorder struct {
+	gin.ResponseWriter
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.Hijack()
+	if err == nil {
+		w.hijacked = true
 	}
+	return conn, brw, err
+}
+
+func (w *hijackRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
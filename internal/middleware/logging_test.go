@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		defer func() { recover() }()
+		c.Next()
+	})
+	router.Use(Logger())
+	router.GET("/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("data: hello\n\n")
+		c.Writer.Flush()
+		time.Sleep(20 * time.Millisecond)
+		// ReverseProxy aborts this way when a stream breaks off
+		panic(http.ErrAbortHandler)
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/ok", "[GET] /ok 192.0.2.1 204"},
+		{"/events", "[GET] /events 192.0.2.1 200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("Expected log line containing %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+}
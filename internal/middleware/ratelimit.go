@@ -23,7 +23,7 @@ Requests exceeding the limit receive HTTP 429 status with a Retry-After header.
 */
 func (rl *RateLimiter) Limit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientID := c.ClientIP()
+		clientID := clientIP(c)
 
 		if !rl.storage.Allow(clientID) {
 			c.Header("Retry-After", "1")
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
 )
 
 func TestNewRateLimiter(t *testing.T) {
@@ -136,3 +138,49 @@ func TestRateLimiterAbort(t *testing.T) {
 		t.Errorf("Expected status 429, got %d", w2.Code)
 	}
 }
+
+func TestRateLimiterUsesResolvedClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(10, 1)
+
+	resolver, err := clientip.NewResolver(config.TrustedProxies{
+		CIDRs:   []string{"10.0.0.0/8"},
+		Headers: []string{"X-Forwarded-For"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(ClientIP(resolver))
+	router.Use(rl.Limit())
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	// Spoofed header from an untrusted peer must not create a fresh bucket
+	for i, forwardedFor := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "203.0.113.5:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if i == 1 && w.Code != http.StatusTooManyRequests {
+			t.Errorf("Spoofed request should be rate limited, got status %d", w.Code)
+		}
+	}
+
+	// Clients behind the trusted proxy get their own buckets
+	for _, forwardedFor := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Client %s behind trusted proxy should be allowed, got status %d", forwardedFor, w.Code)
+		}
+	}
+}
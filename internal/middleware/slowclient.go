@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+MinBodyRate returns a Gin middleware that enforces a minimum upload rate on
+request bodies. After the grace period a client must have sent at least
+rate bytes for every further second, otherwise the connection read deadline
+expires and the request fails instead of pinning a worker indefinitely.
+*/
+func MinBodyRate(rate config.ByteRate, grace time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		c.Request.Body = &minRateBody{
+			ReadCloser: c.Request.Body,
+			controller: http.NewResponseController(c.Writer),
+			start:      time.Now(),
+			rate:       float64(rate),
+			grace:      grace,
+		}
+		c.Next()
+	}
+}
+
+type minRateBody struct {
+	io.ReadCloser
+	controller *http.ResponseController
+	start      time.Time
+	read       int64
+	rate       float64
+	grace      time.Duration
+	disabled   bool
+}
+
+func (b *minRateBody) Read(p []byte) (int, error) {
+	if !b.disabled {
+		allowed := b.grace + time.Duration(float64(b.read+1)/b.rate*float64(time.Second))
+		if err := b.controller.SetReadDeadline(b.start.Add(allowed)); err != nil {
+			b.disabled = true
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+
+	if err == io.EOF && !b.disabled {
+		b.controller.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
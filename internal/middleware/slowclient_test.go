@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMinBodyRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	result := make(chan error, 1)
+
+	router := gin.New()
+	router.Use(MinBodyRate(1000, 100*time.Millisecond))
+	router.POST("/upload", func(c *gin.Context) {
+		_, err := io.ReadAll(c.Request.Body)
+		result <- err
+		c.Status(http.StatusOK)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Announce a large body but only send a few bytes, then stall
+	conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100000\r\n\r\nhello"))
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected slow upload to fail")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Slow upload was not cut off")
+	}
+}
+
+func TestMinBodyRateAllowsFastUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(MinBodyRate(1000, 100*time.Millisecond))
+	router.POST("/upload", func(c *gin.Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusRequestTimeout)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(data))
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/upload", "text/plain", io.LimitReader(zeroReader{}, 50000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "50000" {
+		t.Errorf("Expected fast upload to succeed, got %d %s", resp.StatusCode, body)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -1,42 +1,504 @@
 package proxy
 
 import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+const (
+	StrategyRoundRobin = "round_robin"
+	StrategyLeastConn  = "least_conn"
+	StrategyP2C        = "p2c"
+	StrategyEWMA       = "ewma"
+	StrategyRingHash   = "ring_hash"
+	StrategyMaglev     = "maglev"
+)
+
+const (
+	defaultEWMADecay = 10 * time.Second
+
+	// ewmaFailurePenalty is recorded for failed round trips so that a target
+	// refusing connections quickly does not look like the fastest one.
+	ewmaFailurePenalty = time.Second
 )
 
 /*
-Balancer handles load balancing across multiple backend servers using
-round-robin strategy. Designed to be extensible for other algorithms.
+Balancer handles load balancing across multiple backend servers. The default
+strategy is the smooth weighted round-robin algorithm from nginx: every pick
+adds each target's weight to its current weight, chooses the highest and
+subtracts the total, which interleaves targets evenly instead of sending runs
+of requests to the heaviest one. Load-aware strategies use the in-flight
+counts maintained through Acquire and Release.
 */
 type Balancer struct {
-	counter uint64
-	targets []string
+	mu          sync.Mutex
+	strategy    string
+	decay       time.Duration
+	hashKey     string
+	boundedLoad float64
+	counter     uint64
+	targets     []*target
+	ring        []ringEntry
+	maglev      []*target
+}
+
+type target struct {
+	url           string
+	weight        int
+	currentWeight int
+	inFlight      atomic.Int64
+	ewma          float64
+	lastObserved  time.Time
+	unhealthy     bool
+	ejectedUntil  time.Time
+	circuitUntil  time.Time
+	circuitTrial  bool
 }
 
 func NewBalancer(targets []string) *Balancer {
-	return &Balancer{
-		targets: targets,
-		counter: 0,
+	upstreams := make([]config.Upstream, len(targets))
+	for i, t := range targets {
+		upstreams[i] = config.Upstream{URL: t, Weight: 1}
+	}
+	return NewWeightedBalancer(upstreams)
+}
+
+func NewWeightedBalancer(upstreams []config.Upstream) *Balancer {
+	b, _ := NewBalancerWithStrategy(StrategyRoundRobin, upstreams)
+	return b
+}
+
+func NewBalancerWithStrategy(strategy string, upstreams []config.Upstream) (*Balancer, error) {
+	switch strategy {
+	case "":
+		strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastConn, StrategyP2C, StrategyEWMA, StrategyRingHash, StrategyMaglev:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+
+	b := &Balancer{strategy: strategy, decay: defaultEWMADecay, hashKey: "client_ip"}
+	for _, upstream := range upstreams {
+		b.targets = append(b.targets, &target{url: upstream.URL, weight: upstream.Weight})
+	}
+	b.rebuildHash()
+	return b, nil
+}
+
+/*
+rebuildHash recomputes the ring or Maglev table after the target weights
+change. Must be called with b.mu held once the balancer is in use.
+*/
+func (b *Balancer) rebuildHash() {
+	switch b.strategy {
+	case StrategyRingHash:
+		b.ring = buildRing(b.targets)
+	case StrategyMaglev:
+		b.maglev = buildMaglev(b.targets)
+	}
+}
+
+/*
+NewBalancerFromConfig creates a balancer for a route's load_balancing block.
+*/
+func NewBalancerFromConfig(lb config.LoadBalancing, upstreams []config.Upstream) (*Balancer, error) {
+	b, err := NewBalancerWithStrategy(lb.Strategy, upstreams)
+	if err != nil {
+		return nil, err
+	}
+	if lb.Decay > 0 {
+		b.decay = lb.Decay
+	}
+	if lb.HashKey != "" {
+		b.hashKey = lb.HashKey
+	}
+	b.boundedLoad = lb.BoundedLoad
+	return b, nil
+}
+
+/*
+Pick chooses a target for the request. Consistent-hash strategies hash the
+configured request attribute so the same key keeps landing on the same
+target; every other strategy ignores the request and behaves like Next.
+*/
+func (b *Balancer) Pick(r *http.Request) string {
+	if b.strategy != StrategyRingHash && b.strategy != StrategyMaglev {
+		return b.Next()
+	}
+
+	h := hashString(requestHashKey(r, b.hashKey))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t := b.nextHash(h); t != nil {
+		return t.url
+	}
+	return ""
+}
+
+/*
+PickOther chooses a target that is not in tried, used to send a retry or a
+hedge somewhere else. It takes the least loaded remaining target without
+moving the rotation of the strategy, so the targets of first attempts keep
+alternating while one of them fails. It returns an empty string when every
+available target has already been tried.
+*/
+func (b *Balancer) PickOther(tried []string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var picked *target
+	for _, t := range b.targets {
+		if !t.available() || slices.Contains(tried, t.url) {
+			continue
+		}
+		if picked == nil || t.load() < picked.load() {
+			picked = t
+		}
+	}
+
+	if picked == nil {
+		return ""
 	}
+	return picked.url
 }
 
 func (b *Balancer) Next() string {
-	if len(b.targets) == 0 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var picked *target
+	switch b.strategy {
+	case StrategyLeastConn:
+		picked = b.nextLeastConn()
+	case StrategyP2C:
+		picked = b.nextP2C(func(t *target) float64 { return t.load() })
+	case StrategyEWMA:
+		now := time.Now()
+		picked = b.nextP2C(func(t *target) float64 { return b.cost(t, now) })
+	default:
+		picked = b.nextRoundRobin()
+	}
+
+	if picked == nil {
 		return ""
 	}
+	return picked.url
+}
+
+func (b *Balancer) nextRoundRobin() *target {
+	var best *target
+	total := 0
+	for _, t := range b.targets {
+		if !t.available() {
+			continue
+		}
+		t.currentWeight += t.weight
+		total += t.weight
+		if best == nil || t.currentWeight > best.currentWeight {
+			best = t
+		}
+	}
+
+	if best != nil {
+		best.currentWeight -= total
+	}
+	return best
+}
+
+/*
+nextLeastConn picks the target with the fewest in-flight requests relative
+to its weight. The scan starts at a rotating offset so ties are spread
+instead of always landing on the first target.
+*/
+func (b *Balancer) nextLeastConn() *target {
+	var best *target
+	n := len(b.targets)
+	start := int(b.counter % uint64(max(n, 1)))
+	b.counter++
+
+	for i := 0; i < n; i++ {
+		t := b.targets[(start+i)%n]
+		if !t.available() {
+			continue
+		}
+		if best == nil || t.load() < best.load() {
+			best = t
+		}
+	}
+	return best
+}
+
+/*
+nextP2C samples two distinct targets at random and keeps the one with the
+lower cost, which approaches picking the global minimum without herding onto
+a single target when load information is stale.
+*/
+func (b *Balancer) nextP2C(cost func(*target) float64) *target {
+	candidates := make([]*target, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t.available() {
+			candidates = append(candidates, t)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+
+	i := rand.IntN(len(candidates))
+	j := rand.IntN(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+
+	if cost(candidates[j]) < cost(candidates[i]) {
+		return candidates[j]
+	}
+	return candidates[i]
+}
+
+/*
+available reports whether the target may be picked: it must have a positive
+weight, must not be marked unhealthy, ejected as an outlier or behind an open
+circuit, and must not have a half-open trial request in flight.
+*/
+func (t *target) available() bool {
+	now := time.Now()
+	return t.weight > 0 && !t.unhealthy && !t.circuitTrial &&
+		!now.Before(t.ejectedUntil) && !now.Before(t.circuitUntil)
+}
+
+func (t *target) load() float64 {
+	return float64(t.inFlight.Load()) / float64(t.weight)
+}
+
+/*
+cost implements the peak EWMA score used by Finagle and Linkerd: the decayed
+latency average multiplied by the number of outstanding requests plus one.
+Targets that have not been observed yet cost nothing so they get probed.
+*/
+func (b *Balancer) cost(t *target, now time.Time) float64 {
+	latency := b.decayed(t, now)
+	return latency * float64(t.inFlight.Load()+1) / float64(t.weight)
+}
+
+func (b *Balancer) decayed(t *target, now time.Time) float64 {
+	if t.lastObserved.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(t.lastObserved)
+	return t.ewma * math.Exp(-float64(elapsed)/float64(b.decay))
+}
+
+/*
+Observe records the response latency of a request to the target. Latency
+spikes are adopted immediately (the "peak" part) while improvements are
+blended in with a weight that depends on the time since the last sample.
+Failed requests should pass err so they count as slow rather than fast.
+*/
+func (b *Balancer) Observe(url string, rtt time.Duration, err error) {
+	if err != nil && rtt < ewmaFailurePenalty {
+		rtt = ewmaFailurePenalty
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	sample := float64(rtt)
+	if t.lastObserved.IsZero() || sample > t.ewma {
+		t.ewma = sample
+	} else {
+		w := math.Exp(-float64(now.Sub(t.lastObserved)) / float64(b.decay))
+		t.ewma = t.ewma*w + sample*(1-w)
+	}
+	t.lastObserved = now
+}
+
+/*
+Latency returns the current decayed latency estimate for the target.
+*/
+func (b *Balancer) Latency(url string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t := b.find(url); t != nil {
+		return time.Duration(b.decayed(t, time.Now()))
+	}
+	return 0
+}
+
+/*
+Acquire records that a request is being forwarded to the target; every call
+must be paired with Release once the response has been fully relayed.
+*/
+func (b *Balancer) Acquire(url string) {
+	if t := b.find(url); t != nil {
+		t.inFlight.Add(1)
+	}
+}
+
+func (b *Balancer) Release(url string) {
+	if t := b.find(url); t != nil {
+		t.inFlight.Add(-1)
+	}
+}
+
+func (b *Balancer) InFlight(url string) int64 {
+	if t := b.find(url); t != nil {
+		return t.inFlight.Load()
+	}
+	return 0
+}
+
+func (b *Balancer) find(url string) *target {
+	for _, t := range b.targets {
+		if t.url == url {
+			return t
+		}
+	}
+	return nil
+}
+
+/*
+SetWeight changes the weight of a target at runtime. Current weights are
+kept, so the rotation continues smoothly rather than restarting. A weight of
+zero drains the target.
+*/
+func (b *Balancer) SetWeight(url string, weight int) error {
+	if weight < 0 {
+		return fmt.Errorf("weight cannot be negative")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	if t == nil {
+		return fmt.Errorf("unknown target %s", url)
+	}
+	if t.weight != weight {
+		t.weight = weight
+		b.rebuildHash()
+	}
+	return nil
+}
+
+func (b *Balancer) Weight(url string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	if len(b.targets) == 1 {
-		return b.targets[0]
+	if t := b.find(url); t != nil {
+		return t.weight
 	}
+	return 0
+}
+
+/*
+Available reports whether the target is still part of the balancer and able
+to receive traffic, so callers pinning requests to a target can fall back.
+*/
+func (b *Balancer) Available(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	return t != nil && t.available()
+}
+
+/*
+SetHealthy marks a target as healthy or unhealthy. Unhealthy targets are
+skipped by every strategy but keep their weight and hash placement, so they
+get their old share of traffic back once they recover.
+*/
+func (b *Balancer) SetHealthy(url string, healthy bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	n := atomic.AddUint64(&b.counter, 1)
-	return b.targets[(n-1)%uint64(len(b.targets))]
+	t := b.find(url)
+	if t == nil {
+		return fmt.Errorf("unknown target %s", url)
+	}
+	t.unhealthy = !healthy
+	return nil
+}
+
+/*
+Eject takes a target out of rotation until the given time. Unlike SetHealthy
+the target returns on its own once the ejection expires.
+*/
+func (b *Balancer) Eject(url string, until time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	if t == nil {
+		return fmt.Errorf("unknown target %s", url)
+	}
+	t.ejectedUntil = until
+	return nil
+}
+
+func (b *Balancer) Ejected(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	return t != nil && time.Now().Before(t.ejectedUntil)
+}
+
+/*
+setCircuit blocks a target until the open circuit expires, or while a
+half-open trial request is in flight.
+*/
+func (b *Balancer) setCircuit(url string, openUntil time.Time, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t := b.find(url); t != nil {
+		t.circuitUntil = openUntil
+		t.circuitTrial = trial
+	}
+}
+
+func (b *Balancer) Healthy(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.find(url)
+	return t != nil && !t.unhealthy
+}
+
+func (b *Balancer) Strategy() string {
+	return b.strategy
 }
 
 func (b *Balancer) Targets() []string {
-	return b.targets
+	urls := make([]string, len(b.targets))
+	for i, t := range b.targets {
+		urls[i] = t.url
+	}
+	return urls
 }
 
 func (b *Balancer) Count() int {
 	return len(b.targets)
-}
\ No newline at end of file
+}
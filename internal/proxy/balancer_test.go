@@ -0,0 +1,256 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := NewBalancer([]string{"a", "b", "c"})
+
+	var picks []string
+	for i := 0; i < 6; i++ {
+		picks = append(picks, b.Next())
+	}
+
+	if strings.Join(picks, "") != "abcabc" {
+		t.Errorf("Expected round-robin order abcabc, got %s", strings.Join(picks, ""))
+	}
+}
+
+func TestBalancerEmpty(t *testing.T) {
+	b := NewBalancer(nil)
+	if b.Next() != "" {
+		t.Error("Expected empty target from empty balancer")
+	}
+}
+
+func TestBalancerSmoothWeighted(t *testing.T) {
+	b := NewWeightedBalancer([]config.Upstream{
+		{URL: "a", Weight: 5},
+		{URL: "b", Weight: 1},
+		{URL: "c", Weight: 1},
+	})
+
+	var picks []string
+	for i := 0; i < 7; i++ {
+		picks = append(picks, b.Next())
+	}
+
+	// nginx smooth weighted round-robin interleaves the heavy target
+	if got := strings.Join(picks, ""); got != "aabacaa" {
+		t.Errorf("Expected smooth sequence aabacaa, got %s", got)
+	}
+}
+
+func TestBalancerWeightedDistribution(t *testing.T) {
+	b := NewWeightedBalancer([]config.Upstream{
+		{URL: "large", Weight: 3},
+		{URL: "small", Weight: 1},
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		counts[b.Next()]++
+	}
+
+	if counts["large"] != 300 || counts["small"] != 100 {
+		t.Errorf("Expected 300/100 split, got %v", counts)
+	}
+}
+
+func TestBalancerSetWeight(t *testing.T) {
+	b := NewBalancer([]string{"a", "b"})
+
+	if err := b.SetWeight("b", 0); err != nil {
+		t.Fatalf("Failed to set weight: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if got := b.Next(); got != "a" {
+			t.Errorf("Expected drained target to be skipped, got %s", got)
+		}
+	}
+
+	if err := b.SetWeight("b", 3); err != nil {
+		t.Fatalf("Failed to set weight: %v", err)
+	}
+	if b.Weight("b") != 3 {
+		t.Errorf("Expected weight 3, got %d", b.Weight("b"))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[b.Next()]++
+	}
+	if counts["b"] < 29 || counts["b"] > 31 {
+		t.Errorf("Expected ~3:1 split after reweighting, got %v", counts)
+	}
+
+	if err := b.SetWeight("missing", 1); err == nil {
+		t.Error("Expected error for unknown target")
+	}
+	if err := b.SetWeight("a", -1); err == nil {
+		t.Error("Expected error for negative weight")
+	}
+}
+
+func TestBalancerUnknownStrategy(t *testing.T) {
+	if _, err := NewBalancerWithStrategy("random", nil); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func TestBalancerLeastConn(t *testing.T) {
+	b, err := NewBalancerWithStrategy(StrategyLeastConn, []config.Upstream{
+		{URL: "a", Weight: 1},
+		{URL: "b", Weight: 1},
+		{URL: "c", Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a is stuck on slow requests, b has one in flight
+	b.Acquire("a")
+	b.Acquire("a")
+	b.Acquire("b")
+
+	for i := 0; i < 3; i++ {
+		if got := b.Next(); got != "c" {
+			t.Errorf("Expected least loaded target c, got %s", got)
+		}
+	}
+
+	b.Acquire("c")
+	b.Acquire("c")
+	if got := b.Next(); got != "b" {
+		t.Errorf("Expected b once c is busier, got %s", got)
+	}
+
+	b.Release("a")
+	b.Release("a")
+	if b.InFlight("a") != 0 {
+		t.Errorf("Expected 0 in flight for a, got %d", b.InFlight("a"))
+	}
+	if got := b.Next(); got != "a" {
+		t.Errorf("Expected idle target a, got %s", got)
+	}
+}
+
+func TestBalancerLeastConnSpreadsTies(t *testing.T) {
+	b, _ := NewBalancerWithStrategy(StrategyLeastConn, []config.Upstream{
+		{URL: "a", Weight: 1},
+		{URL: "b", Weight: 1},
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[b.Next()]++
+	}
+	if counts["a"] != 5 || counts["b"] != 5 {
+		t.Errorf("Expected idle ties to alternate, got %v", counts)
+	}
+}
+
+func TestBalancerP2C(t *testing.T) {
+	b, err := NewBalancerWithStrategy(StrategyP2C, []config.Upstream{
+		{URL: "slow", Weight: 1},
+		{URL: "fast", Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Acquire("slow")
+	}
+
+	// With two targets both are always sampled, so the idle one always wins
+	for i := 0; i < 20; i++ {
+		if got := b.Next(); got != "fast" {
+			t.Errorf("Expected p2c to avoid loaded target, got %s", got)
+		}
+	}
+}
+
+func TestBalancerP2CAvoidsLoadedTarget(t *testing.T) {
+	b, _ := NewBalancerWithStrategy(StrategyP2C, []config.Upstream{
+		{URL: "a", Weight: 1},
+		{URL: "b", Weight: 1},
+		{URL: "c", Weight: 1},
+		{URL: "d", Weight: 1},
+	})
+
+	for i := 0; i < 100; i++ {
+		b.Acquire("a")
+	}
+
+	for i := 0; i < 200; i++ {
+		if got := b.Next(); got == "a" {
+			t.Fatal("Expected heavily loaded target never to win a comparison")
+		}
+	}
+}
+
+func TestBalancerEWMAPrefersFasterTarget(t *testing.T) {
+	b, err := NewBalancerFromConfig(config.LoadBalancing{Strategy: StrategyEWMA, Decay: 10 * time.Second}, []config.Upstream{
+		{URL: "far", Weight: 1},
+		{URL: "near", Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Observe("far", 80*time.Millisecond, nil)
+	b.Observe("near", 5*time.Millisecond, nil)
+
+	for i := 0; i < 20; i++ {
+		if got := b.Next(); got != "near" {
+			t.Errorf("Expected lower latency target, got %s", got)
+		}
+	}
+
+	// Outstanding requests multiply the cost, so a busy fast target loses
+	for i := 0; i < 20; i++ {
+		b.Acquire("near")
+	}
+	if got := b.Next(); got != "far" {
+		t.Errorf("Expected busy near target to lose to idle far one, got %s", got)
+	}
+}
+
+func TestBalancerEWMAPeak(t *testing.T) {
+	b, _ := NewBalancerFromConfig(config.LoadBalancing{Strategy: StrategyEWMA, Decay: time.Hour}, []config.Upstream{
+		{URL: "a", Weight: 1},
+	})
+
+	b.Observe("a", 10*time.Millisecond, nil)
+	b.Observe("a", 200*time.Millisecond, nil)
+	if latency := b.Latency("a"); latency < 199*time.Millisecond {
+		t.Errorf("Expected latency spike to be adopted immediately, got %v", latency)
+	}
+
+	// Improvements are blended in slowly with a long decay
+	b.Observe("a", 10*time.Millisecond, nil)
+	if latency := b.Latency("a"); latency < 190*time.Millisecond {
+		t.Errorf("Expected improvement to be smoothed, got %v", latency)
+	}
+}
+
+func TestBalancerEWMAFailurePenalty(t *testing.T) {
+	b, _ := NewBalancerFromConfig(config.LoadBalancing{Strategy: StrategyEWMA}, []config.Upstream{
+		{URL: "broken", Weight: 1},
+		{URL: "ok", Weight: 1},
+	})
+
+	b.Observe("broken", time.Millisecond, errors.New("connection refused"))
+	b.Observe("ok", 50*time.Millisecond, nil)
+
+	if got := b.Next(); got != "ok" {
+		t.Errorf("Expected fast-failing target to be penalised, got %s", got)
+	}
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+	"github.com/smartcraze/gothrottle/internal/ratelimit"
+)
+
+const maxThrottleChunk = 32 * 1024
+
+/*
+bandwidthLimiter keeps per-client byte buckets for a route with its own
+bandwidth block, or for all the routes sharing the global one. Buckets hold
+one second worth of bytes, so a client may burst up to its per-second rate.
+*/
+type bandwidthLimiter struct {
+	upload        *ratelimit.Storage
+	download      *ratelimit.Storage
+	uploadChunk   int
+	downloadChunk int
+}
+
+func newBandwidthLimiter(bw *config.Bandwidth) *bandwidthLimiter {
+	if bw == nil || (bw.Upload <= 0 && bw.Download <= 0) {
+		return nil
+	}
+
+	limiter := &bandwidthLimiter{}
+	if bw.Upload > 0 {
+		limiter.upload = ratelimit.NewStorage(float64(bw.Upload), int(bw.Upload))
+		limiter.uploadChunk = throttleChunk(bw.Upload)
+	}
+	if bw.Download > 0 {
+		limiter.download = ratelimit.NewStorage(float64(bw.Download), int(bw.Download))
+		limiter.downloadChunk = throttleChunk(bw.Download)
+	}
+	return limiter
+}
+
+func throttleChunk(rate config.ByteRate) int {
+	if rate < maxThrottleChunk {
+		return int(rate)
+	}
+	return maxThrottleChunk
+}
+
+/*
+wrap throttles the request body and the response writer of a single request
+using the buckets of the requesting client.
+*/
+func (l *bandwidthLimiter) wrap(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	clientID := clientip.FromRequest(r)
+
+	if l.upload != nil && r.Body != nil && r.Body != http.NoBody {
+		r.Body = ratelimit.NewReader(r.Context(), r.Body, l.upload.GetBucket(clientID), l.uploadChunk)
+	}
+
+	if l.download != nil {
+		w = &throttledResponseWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			bucket:         l.download.GetBucket(clientID),
+			chunk:          l.downloadChunk,
+		}
+	}
+
+	return w, r
+}
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	bucket *ratelimit.TokenBucket
+	chunk  int
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > w.chunk {
+			n = w.chunk
+		}
+
+		if err := ratelimit.WaitN(w.ctx, w.bucket, n); err != nil {
+			return written, err
+		}
+
+		m, err := w.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *throttledResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
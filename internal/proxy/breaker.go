@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+/*
+circuitBreaker keeps a closed/open/half-open circuit for every upstream of
+a route. While a circuit is open the balancer skips the target, so requests
+fail over to other targets or get a fast 503 instead of waiting on a backend
+that is known to be failing. After the open period trial requests are let
+through one at a time to decide whether to close the circuit again.
+*/
+type circuitBreaker struct {
+	cfg      config.CircuitBreaker
+	route    string
+	balancer *Balancer
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trial       bool
+	successes   int
+	transitions map[circuitState]uint64
+	rejected    uint64
+}
+
+func newCircuitBreaker(cfg *config.CircuitBreaker, route string, balancer *Balancer) *circuitBreaker {
+	if cfg == nil {
+		return nil
+	}
+
+	cb := &circuitBreaker{
+		cfg:      *cfg,
+		route:    route,
+		balancer: balancer,
+		circuits: make(map[string]*circuit),
+	}
+	for _, t := range balancer.Targets() {
+		cb.circuits[t] = &circuit{
+			windowStart: time.Now(),
+			transitions: make(map[circuitState]uint64),
+		}
+	}
+	return cb
+}
+
+/*
+allow reports whether a request may be sent to target. A half-open circuit
+admits a single trial request and blocks the target until it completes.
+*/
+func (cb *circuitBreaker) allow(target string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuits[target]
+	if c == nil {
+		return true
+	}
+
+	if c.state == circuitOpen && time.Since(c.openedAt) >= cb.cfg.OpenDuration {
+		cb.transition(target, c, circuitHalfOpen)
+		c.successes = 0
+	}
+
+	switch c.state {
+	case circuitOpen:
+		c.rejected++
+		return false
+	case circuitHalfOpen:
+		if c.trial {
+			c.rejected++
+			return false
+		}
+		c.trial = true
+		cb.balancer.setCircuit(target, time.Time{}, true)
+	}
+	return true
+}
+
+/*
+reject counts a request turned away because the balancer found no target to
+send it to while circuits were blocking some of them, either open or with a
+half-open trial in flight. Each blocking circuit counts the rejection. It
+reports whether any circuit was blocking, so targets that are unavailable
+for other reasons still get the usual "no upstream" answer.
+*/
+func (cb *circuitBreaker) reject() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	blocked := false
+	for _, c := range cb.circuits {
+		open := c.state == circuitOpen && time.Since(c.openedAt) < cb.cfg.OpenDuration
+		if open || (c.state == circuitHalfOpen && c.trial) {
+			c.rejected++
+			blocked = true
+		}
+	}
+	return blocked
+}
+
+/*
+record updates the circuit with the outcome of a request admitted by allow.
+*/
+func (cb *circuitBreaker) record(target string, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuits[target]
+	if c == nil {
+		return
+	}
+
+	switch c.state {
+	case circuitClosed:
+		now := time.Now()
+		if now.Sub(c.windowStart) >= cb.cfg.Window {
+			c.windowStart = now
+			c.requests = 0
+			c.failures = 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= cb.cfg.MinRequests && float64(c.failures)/float64(c.requests) >= cb.cfg.ErrorRatio {
+			cb.open(target, c)
+		}
+
+	case circuitHalfOpen:
+		if !c.trial {
+			// Outcome of a request admitted before the circuit opened
+			return
+		}
+		c.trial = false
+		if failed {
+			cb.open(target, c)
+			return
+		}
+		c.successes++
+		if c.successes >= cb.cfg.HalfOpenRequests {
+			cb.transition(target, c, circuitClosed)
+			c.windowStart = time.Now()
+			c.requests = 0
+			c.failures = 0
+		}
+		cb.balancer.setCircuit(target, time.Time{}, false)
+	}
+}
+
+/*
+cancel releases a half-open trial slot when the request ended without a
+usable outcome, for example because the client went away.
+*/
+func (cb *circuitBreaker) cancel(target string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c := cb.circuits[target]; c != nil && c.state == circuitHalfOpen && c.trial {
+		c.trial = false
+		cb.balancer.setCircuit(target, time.Time{}, false)
+	}
+}
+
+func (cb *circuitBreaker) open(target string, c *circuit) {
+	c.openedAt = time.Now()
+	c.trial = false
+	cb.transition(target, c, circuitOpen)
+	cb.balancer.setCircuit(target, c.openedAt.Add(cb.cfg.OpenDuration), false)
+}
+
+func (cb *circuitBreaker) transition(target string, c *circuit, to circuitState) {
+	log.Printf("Circuit breaker: route %s target %s %s -> %s", cb.route, target, c.state, to)
+	c.state = to
+	c.transitions[to]++
+}
+
+/*
+circuitStats is a snapshot of one circuit used for metrics.
+*/
+type circuitStats struct {
+	state       circuitState
+	transitions map[circuitState]uint64
+	rejected    uint64
+}
+
+func (cb *circuitBreaker) stats(target string) (circuitStats, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuits[target]
+	if c == nil {
+		return circuitStats{}, false
+	}
+
+	transitions := make(map[circuitState]uint64, len(c.transitions))
+	for s, n := range c.transitions {
+		transitions[s] = n
+	}
+	return circuitStats{state: c.state, transitions: transitions, rejected: c.rejected}, true
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func newTestBreaker(openDuration time.Duration) (*circuitBreaker, *Balancer) {
+	balancer := NewBalancer([]string{"http://a", "http://b"})
+	cb := newCircuitBreaker(&config.CircuitBreaker{
+		ErrorRatio:       0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+		OpenDuration:     openDuration,
+		HalfOpenRequests: 2,
+	}, "/api", balancer)
+	return cb, balancer
+}
+
+func TestCircuitBreakerOpensOnErrorRatio(t *testing.T) {
+	cb, balancer := newTestBreaker(time.Minute)
+
+	// Below the minimum volume a 100% error ratio does not trip
+	for i := 0; i < 3; i++ {
+		cb.record("http://a", true)
+	}
+	if state := cb.circuits["http://a"].state; state != circuitClosed {
+		t.Fatalf("Expected circuit to stay closed below min requests, got %s", state)
+	}
+
+	cb.record("http://a", false)
+	if state := cb.circuits["http://a"].state; state != circuitOpen {
+		t.Fatalf("Expected circuit to open at 3/4 errors, got %s", state)
+	}
+
+	if cb.allow("http://a") {
+		t.Error("Expected open circuit to reject requests")
+	}
+	if balancer.Available("http://a") {
+		t.Error("Expected balancer to skip target with open circuit")
+	}
+	for i := 0; i < 4; i++ {
+		if got := balancer.Next(); got != "http://b" {
+			t.Errorf("Expected traffic to fail over to http://b, got %s", got)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb, balancer := newTestBreaker(10 * time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		cb.record("http://a", true)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if !balancer.Available("http://a") {
+		t.Fatal("Expected target to become available after the open duration")
+	}
+	if !cb.allow("http://a") {
+		t.Fatal("Expected a trial request to be admitted")
+	}
+	if cb.circuits["http://a"].state != circuitHalfOpen {
+		t.Errorf("Expected half-open circuit, got %s", cb.circuits["http://a"].state)
+	}
+	if cb.allow("http://a") || balancer.Available("http://a") {
+		t.Error("Expected only one trial request at a time")
+	}
+
+	// A failed trial opens the circuit again
+	cb.record("http://a", true)
+	if cb.circuits["http://a"].state != circuitOpen {
+		t.Fatalf("Expected failed trial to reopen circuit, got %s", cb.circuits["http://a"].state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !cb.allow("http://a") {
+			t.Fatalf("Expected trial %d to be admitted", i+1)
+		}
+		cb.record("http://a", false)
+	}
+	if cb.circuits["http://a"].state != circuitClosed {
+		t.Errorf("Expected circuit to close after 2 successful trials, got %s", cb.circuits["http://a"].state)
+	}
+
+	stats, _ := cb.stats("http://a")
+	if stats.transitions[circuitOpen] != 2 || stats.transitions[circuitHalfOpen] != 2 || stats.transitions[circuitClosed] != 1 {
+		t.Errorf("Unexpected transition counts %v", stats.transitions)
+	}
+}
+
+func TestCircuitBreakerCancelReleasesTrial(t *testing.T) {
+	cb, balancer := newTestBreaker(time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		cb.record("http://a", true)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	cb.allow("http://a")
+	cb.cancel("http://a")
+	if !balancer.Available("http://a") || !cb.allow("http://a") {
+		t.Error("Expected cancelled trial to free the half-open slot")
+	}
+}
+
+func TestHandleCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path:   "/api",
+		Target: backend.URL,
+		CircuitBreaker: &config.CircuitBreaker{
+			ErrorRatio:       0.5,
+			MinRequests:      3,
+			Window:           time.Minute,
+			OpenDuration:     time.Minute,
+			HalfOpenRequests: 1,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api", nil)
+		handler.Handle(c)
+		return c.Writer.Status()
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := serve(); code != http.StatusInternalServerError {
+			t.Fatalf("Expected upstream 500, got %d", code)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := serve(); code != http.StatusServiceUnavailable {
+			t.Errorf("Expected fast 503 with open circuit, got %d", code)
+		}
+	}
+	if hits.Load() != 3 {
+		t.Errorf("Expected open circuit to stop upstream traffic, got %d hits", hits.Load())
+	}
+
+	var metrics strings.Builder
+	if err := handler.WriteMetrics(&metrics); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	for _, expected := range []string{
+		`gothrottle_upstream_circuit_state{route="0",target="` + backend.URL + `"} 1`,
+		`gothrottle_upstream_circuit_rejected_total{route="0",target="` + backend.URL + `"} 5`,
+	} {
+		if !strings.Contains(metrics.String(), expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, metrics.String())
+		}
+	}
+}
+
+func TestHandleCircuitTrialTaken(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	recovering, healthy := newBackend("recovering"), newBackend("healthy")
+	defer recovering.Close()
+	defer healthy.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path: "/api",
+		Targets: []config.Upstream{
+			{URL: recovering.URL, Weight: 1},
+			{URL: healthy.URL, Weight: 1},
+		},
+		CircuitBreaker: &config.CircuitBreaker{
+			ErrorRatio:       0.5,
+			MinRequests:      4,
+			Window:           time.Minute,
+			OpenDuration:     10 * time.Millisecond,
+			HalfOpenRequests: 1,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	rp := handler.proxies[0]
+
+	for i := 0; i < 4; i++ {
+		rp.breaker.record(recovering.URL, true)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Another request claimed the trial after these picked the target,
+	// which the balancer still reports available
+	if !rp.breaker.allow(recovering.URL) {
+		t.Fatal("Expected a trial request to be admitted")
+	}
+	rp.balancer.setCircuit(recovering.URL, time.Time{}, false)
+
+	gin.SetMode(gin.TestMode)
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api", nil)
+		handler.Handle(c)
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "healthy" {
+			t.Errorf("Expected request to fall back to the healthy target, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestWriteMetricsLabels(t *testing.T) {
+	breaker := &config.CircuitBreaker{ErrorRatio: 0.5, MinRequests: 3, Window: time.Minute, OpenDuration: time.Minute, HalfOpenRequests: 1}
+	handler, err := NewHandler([]config.Route{
+		{Name: "public", Path: "/api", Hosts: []string{"api.example.com"}, Target: "http://10.0.0.1:8000", CircuitBreaker: breaker},
+		{Path: "/api", Hosts: []string{"admin.example.com"}, Target: "http://10.0.0.1:8000", CircuitBreaker: breaker},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	var metrics strings.Builder
+	if err := handler.WriteMetrics(&metrics); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	for _, expected := range []string{
+		`gothrottle_upstream_circuit_state{route="public",target="http://10.0.0.1:8000"} 0`,
+		`gothrottle_upstream_circuit_state{route="1",target="http://10.0.0.1:8000"} 0`,
+	} {
+		if !strings.Contains(metrics.String(), expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, metrics.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+)
+
+// originHeaders describe the original request rather than the proxy chain
+var originHeaders = []string{
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+}
+
+var chainHeaders = []string{
+	"X-Forwarded-For",
+	"Forwarded",
+}
+
+/*
+setForwardedHeaders tells the upstream how the client reached the proxy so it
+can build absolute URLs. Incoming values the resolver decided not to keep are
+dropped first. X-Forwarded-Proto, -Host and -Port describe the original
+request: values from trusted proxies are kept and only missing ones are set,
+while those from other peers are always replaced. This hop is appended to
+the Forwarded list, and X-Forwarded-For is appended by
+httputil.ReverseProxy once the Director returns.
+*/
+func setForwardedHeaders(req *http.Request) {
+	switch clientip.ForwardingFromRequest(req) {
+	case clientip.ForwardDrop:
+		for _, name := range chainHeaders {
+			req.Header.Del(name)
+		}
+		fallthrough
+	case clientip.ForwardAppend:
+		for _, name := range originHeaders {
+			req.Header.Del(name)
+		}
+	}
+
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" && req.Host != "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+	if req.Header.Get("X-Forwarded-Port") == "" {
+		req.Header.Set("X-Forwarded-Port", requestPort(req.Host, proto))
+	}
+
+	element := forwardedElement(req.RemoteAddr, req.Host, proto)
+	if prior := req.Header.Values("Forwarded"); len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	req.Header.Set("Forwarded", element)
+}
+
+func requestPort(host, proto string) string {
+	if _, port, err := net.SplitHostPort(host); err == nil && port != "" {
+		return port
+	}
+	if proto == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+/*
+forwardedElement builds the RFC 7239 element describing this hop. IPv6
+addresses are bracketed and values that are not tokens are quoted.
+*/
+func forwardedElement(remoteAddr, host, proto string) string {
+	node := "unknown"
+	if ip := net.ParseIP(clientip.RemoteIP(remoteAddr)); ip != nil {
+		node = ip.String()
+		if ip.To4() == nil {
+			node = "[" + node + "]"
+		}
+	}
+
+	element := "for=" + quoteForwarded(node)
+	if host != "" {
+		element += ";host=" + quoteForwarded(host)
+	}
+	return element + ";proto=" + proto
+}
+
+func quoteForwarded(value string) string {
+	for _, r := range value {
+		if !isTokenRune(r) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+func isTokenRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
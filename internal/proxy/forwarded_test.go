@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestSetForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		tls        bool
+		forwarding clientip.Forwarding
+		incoming   map[string]string
+		expected   map[string]string
+	}{
+		{
+			name:       "plain http",
+			host:       "example.com",
+			remoteAddr: "203.0.113.7:5000",
+			forwarding: clientip.ForwardKeep,
+			expected: map[string]string{
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "example.com",
+				"X-Forwarded-Port":  "80",
+				"Forwarded":         "for=203.0.113.7;host=example.com;proto=http",
+			},
+		},
+		{
+			name:       "tls with explicit port and ipv6 peer",
+			host:       "example.com:8443",
+			remoteAddr: "[2001:db8::1]:5000",
+			tls:        true,
+			forwarding: clientip.ForwardKeep,
+			expected: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Port":  "8443",
+				"Forwarded":         `for="[2001:db8::1]";host="example.com:8443";proto=https`,
+			},
+		},
+		{
+			name:       "trusted peer keeps incoming values",
+			host:       "internal:8080",
+			remoteAddr: "10.0.0.2:5000",
+			forwarding: clientip.ForwardKeep,
+			incoming: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "example.com",
+				"Forwarded":         "for=198.51.100.1;proto=https",
+			},
+			expected: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "example.com",
+				"X-Forwarded-Port":  "8080",
+				"Forwarded":         `for=198.51.100.1;proto=https, for=10.0.0.2;host="internal:8080";proto=http`,
+			},
+		},
+		{
+			name:       "untrusted append replaces origin values",
+			host:       "example.com",
+			remoteAddr: "203.0.113.7:5000",
+			forwarding: clientip.ForwardAppend,
+			incoming: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "evil.example",
+				"X-Forwarded-Port":  "8443",
+				"Forwarded":         "for=198.51.100.1",
+			},
+			expected: map[string]string{
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "example.com",
+				"X-Forwarded-Port":  "80",
+				"Forwarded":         "for=198.51.100.1, for=203.0.113.7;host=example.com;proto=http",
+			},
+		},
+		{
+			name:       "overwrite drops incoming values",
+			host:       "example.com",
+			remoteAddr: "203.0.113.7:5000",
+			forwarding: clientip.ForwardDrop,
+			incoming: map[string]string{
+				"X-Forwarded-For":   "1.2.3.4",
+				"X-Forwarded-Proto": "https",
+				"Forwarded":         "for=1.2.3.4",
+			},
+			expected: map[string]string{
+				"X-Forwarded-For":   "",
+				"X-Forwarded-Proto": "http",
+				"Forwarded":         "for=203.0.113.7;host=example.com;proto=http",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.incoming {
+				req.Header.Set(k, v)
+			}
+			req = req.WithContext(clientip.WithForwarding(req.Context(), tt.forwarding))
+
+			setForwardedHeaders(req)
+
+			for k, v := range tt.expected {
+				if got := req.Header.Get(k); got != v {
+					t.Errorf("Expected %s %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleForwardedHeaders(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{Path: "/api", Target: backend.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	c.Request.Host = "shop.example.com"
+	c.Request.RemoteAddr = "203.0.113.7:5000"
+	c.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	c.Request = c.Request.WithContext(clientip.WithForwarding(c.Request.Context(), clientip.ForwardDrop))
+	handler.Handle(c)
+
+	if got := received.Get("X-Forwarded-For"); got != "203.0.113.7" {
+		t.Errorf("Expected spoofed X-Forwarded-For to be replaced, got %q", got)
+	}
+	if got := received.Get("X-Forwarded-Host"); got != "shop.example.com" {
+		t.Errorf("Expected X-Forwarded-Host shop.example.com, got %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+)
+
+const (
+	// ringReplicas is the number of virtual nodes per unit of weight on the
+	// hash ring; more replicas give a smoother key distribution.
+	ringReplicas = 160
+
+	// maglevTableSize must be prime and much larger than the number of
+	// targets for the lookup table to be balanced.
+	maglevTableSize = 65537
+)
+
+type ringEntry struct {
+	hash   uint64
+	target *target
+}
+
+/*
+hashString is FNV-1a followed by the splitmix64 finalizer, which spreads
+similar inputs such as "host#1" and "host#2" across the whole hash space.
+*/
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+/*
+buildRing places weight*ringReplicas virtual nodes per target on a sorted
+ring. Adding or removing a target only moves the keys that fall between its
+own nodes and their predecessors.
+*/
+func buildRing(targets []*target) []ringEntry {
+	var ring []ringEntry
+	for _, t := range targets {
+		for i := 0; i < t.weight*ringReplicas; i++ {
+			ring = append(ring, ringEntry{
+				hash:   hashString(t.url + "#" + strconv.Itoa(i)),
+				target: t,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+/*
+buildMaglev fills the Maglev lookup table. Each target walks its own
+permutation of the table claiming the next free slot in turn, taking weight
+turns per round, so every target owns a share of slots proportional to its
+weight and a membership change reshuffles as few slots as possible.
+*/
+func buildMaglev(targets []*target) []*target {
+	var active []*target
+	for _, t := range targets {
+		if t.weight > 0 {
+			active = append(active, t)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	offsets := make([]uint64, len(active))
+	skips := make([]uint64, len(active))
+	next := make([]uint64, len(active))
+	for i, t := range active {
+		offsets[i] = hashString("offset:"+t.url) % maglevTableSize
+		skips[i] = hashString("skip:"+t.url)%(maglevTableSize-1) + 1
+	}
+
+	table := make([]*target, maglevTableSize)
+	filled := 0
+	for filled < maglevTableSize {
+		for i, t := range active {
+			for turn := 0; turn < t.weight && filled < maglevTableSize; turn++ {
+				slot := (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				for table[slot] != nil {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				}
+				table[slot] = t
+				next[i]++
+				filled++
+			}
+		}
+	}
+	return table
+}
+
+/*
+nextHash maps a key hash to a target. Targets that are drained, unhealthy or
+already above the bounded-load capacity are skipped by walking forward along the ring
+or table, so overflow lands on a consistent neighbour.
+*/
+func (b *Balancer) nextHash(h uint64) *target {
+	capacity := b.loadCapacity()
+	eligible := func(t *target) bool {
+		return t.available() && (capacity == 0 || t.inFlight.Load() < capacity)
+	}
+
+	switch b.strategy {
+	case StrategyMaglev:
+		if len(b.maglev) == 0 {
+			return nil
+		}
+		for i := uint64(0); i < uint64(len(b.maglev)); i++ {
+			if t := b.maglev[(h+i)%uint64(len(b.maglev))]; eligible(t) {
+				return t
+			}
+		}
+	default:
+		if len(b.ring) == 0 {
+			return nil
+		}
+		start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= h })
+		for i := 0; i < len(b.ring); i++ {
+			if t := b.ring[(start+i)%len(b.ring)].target; eligible(t) {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+/*
+loadCapacity returns the per-target in-flight cap for consistent hashing
+with bounded loads: BoundedLoad times the average load including the request
+being placed. Zero means unbounded.
+*/
+func (b *Balancer) loadCapacity() int64 {
+	if b.boundedLoad <= 1 {
+		return 0
+	}
+
+	var total int64
+	active := 0
+	for _, t := range b.targets {
+		if t.available() {
+			total += t.inFlight.Load()
+			active++
+		}
+	}
+	if active == 0 {
+		return 0
+	}
+
+	return int64(math.Ceil(b.boundedLoad * float64(total+1) / float64(active)))
+}
+
+/*
+requestHashKey extracts the attribute named by a hash_key setting. Requests
+missing the header or cookie fall back to the client IP so they still stick.
+*/
+func requestHashKey(r *http.Request, key string) string {
+	switch {
+	case key == "path":
+		return r.URL.Path
+	case strings.HasPrefix(key, "header:"):
+		if value := r.Header.Get(strings.TrimPrefix(key, "header:")); value != "" {
+			return value
+		}
+	case strings.HasPrefix(key, "cookie:"):
+		if cookie, err := r.Cookie(strings.TrimPrefix(key, "cookie:")); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	return clientip.FromRequest(r)
+}
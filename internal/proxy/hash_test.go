@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func hashBalancer(t *testing.T, strategy string, boundedLoad float64, urls ...string) *Balancer {
+	var upstreams []config.Upstream
+	for _, url := range urls {
+		upstreams = append(upstreams, config.Upstream{URL: url, Weight: 1})
+	}
+
+	b, err := NewBalancerFromConfig(config.LoadBalancing{
+		Strategy:    strategy,
+		HashKey:     "header:X-User-ID",
+		BoundedLoad: boundedLoad,
+	}, upstreams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func userRequest(id string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	req.Header.Set("X-User-ID", id)
+	return req
+}
+
+func TestConsistentHashAffinity(t *testing.T) {
+	for _, strategy := range []string{StrategyRingHash, StrategyMaglev} {
+		t.Run(strategy, func(t *testing.T) {
+			b := hashBalancer(t, strategy, 0, "a", "b", "c", "d")
+
+			for i := 0; i < 100; i++ {
+				id := fmt.Sprintf("user-%d", i)
+				first := b.Pick(userRequest(id))
+				for j := 0; j < 3; j++ {
+					if got := b.Pick(userRequest(id)); got != first {
+						t.Fatalf("Expected %s to stick to %s, got %s", id, first, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	for _, strategy := range []string{StrategyRingHash, StrategyMaglev} {
+		t.Run(strategy, func(t *testing.T) {
+			b := hashBalancer(t, strategy, 0, "a", "b", "c", "d")
+
+			counts := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				counts[b.Pick(userRequest(fmt.Sprintf("user-%d", i)))]++
+			}
+
+			for _, url := range []string{"a", "b", "c", "d"} {
+				if counts[url] < 1750 || counts[url] > 3250 {
+					t.Errorf("Expected roughly even distribution, got %v", counts)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashMinimalDisruption(t *testing.T) {
+	for _, strategy := range []string{StrategyRingHash, StrategyMaglev} {
+		t.Run(strategy, func(t *testing.T) {
+			b := hashBalancer(t, strategy, 0, "a", "b", "c", "d", "e")
+
+			before := make(map[string]string)
+			for i := 0; i < 5000; i++ {
+				id := fmt.Sprintf("user-%d", i)
+				before[id] = b.Pick(userRequest(id))
+			}
+
+			if err := b.SetWeight("c", 0); err != nil {
+				t.Fatal(err)
+			}
+
+			moved := 0
+			for id, previous := range before {
+				got := b.Pick(userRequest(id))
+				if got == "c" {
+					t.Fatalf("Removed target c still receives %s", id)
+				}
+				if previous != "c" && got != previous {
+					moved++
+				}
+			}
+
+			// Keys that were not on the removed target should (almost) all stay put
+			if moved > len(before)/20 {
+				t.Errorf("Expected minimal remapping, %d of %d unaffected keys moved", moved, len(before))
+			}
+		})
+	}
+}
+
+func TestConsistentHashBoundedLoad(t *testing.T) {
+	b := hashBalancer(t, StrategyRingHash, 1.25, "a", "b", "c", "d")
+
+	hot := b.Pick(userRequest("hot-user"))
+	for i := 0; i < 4; i++ {
+		b.Acquire(hot)
+	}
+
+	// Capacity is ceil(1.25 * 5 / 4) = 2, so the hot target is full
+	if got := b.Pick(userRequest("hot-user")); got == hot {
+		t.Errorf("Expected overflow to spill to another target, still got %s", got)
+	}
+
+	unbounded := hashBalancer(t, StrategyRingHash, 0, "a", "b", "c", "d")
+	for i := 0; i < 4; i++ {
+		unbounded.Acquire(hot)
+	}
+	if got := unbounded.Pick(userRequest("hot-user")); got != hot {
+		t.Errorf("Expected unbounded hashing to ignore load, got %s", got)
+	}
+}
+
+func TestRequestHashKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Tenant", "acme")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"path", "/api/items"},
+		{"client_ip", "192.0.2.1"},
+		{"header:X-Tenant", "acme"},
+		{"cookie:session", "abc123"},
+		{"header:X-Missing", "192.0.2.1"},
+		{"cookie:missing", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		if got := requestHashKey(req, tt.key); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.key, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+// requestIDHeader is reused as the {request_id} of a request when the client
+// or an upstream load balancer already assigned one.
+const requestIDHeader = "X-Request-ID"
+
+/*
+headerRules edits request or response headers of a route. Rules run in a
+fixed order: remove, rename, set and add. Renames and edits are sorted by
+header name so the result does not depend on map iteration order.
+perTarget is set when a value refers to {upstream}, so the rules must be
+applied again for each target a request is retried or hedged on.
+*/
+type headerRules struct {
+	remove    []string
+	rename    [][2]string
+	set       []headerEdit
+	add       []headerEdit
+	perTarget bool
+}
+
+type headerEdit struct {
+	name  string
+	value headerTemplate
+}
+
+func newHeaderRules(cfg *config.HeaderRules) (*headerRules, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	rules := &headerRules{remove: cfg.Remove}
+	for _, from := range sortedKeys(cfg.Rename) {
+		rules.rename = append(rules.rename, [2]string{from, cfg.Rename[from]})
+	}
+
+	var err error
+	if rules.set, err = parseHeaderEdits(cfg.Set); err != nil {
+		return nil, err
+	}
+	if rules.add, err = parseHeaderEdits(cfg.Add); err != nil {
+		return nil, err
+	}
+	for _, edit := range slices.Concat(rules.set, rules.add) {
+		rules.perTarget = rules.perTarget || edit.value.uses("upstream")
+	}
+	return rules, nil
+}
+
+func parseHeaderEdits(values map[string]string) ([]headerEdit, error) {
+	var edits []headerEdit
+	for _, name := range sortedKeys(values) {
+		value, err := parseHeaderTemplate(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		edits = append(edits, headerEdit{name: name, value: value})
+	}
+	return edits, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (r *headerRules) apply(h http.Header, vars headerVars) {
+	for _, name := range r.remove {
+		h.Del(name)
+	}
+	for _, rename := range r.rename {
+		values := slices.Clone(h.Values(rename[0]))
+		if len(values) == 0 {
+			continue
+		}
+		h.Del(rename[0])
+		for _, value := range values {
+			h.Add(rename[1], value)
+		}
+	}
+	for _, edit := range r.set {
+		h.Set(edit.name, edit.value.render(vars))
+	}
+	for _, edit := range r.add {
+		h.Add(edit.name, edit.value.render(vars))
+	}
+}
+
+/*
+headerTemplate is a header value split into literal text and {variable}
+references, parsed once when the route is built.
+*/
+type headerTemplate []headerSegment
+
+type headerSegment struct {
+	literal  string
+	variable string
+}
+
+func parseHeaderTemplate(s string) (headerTemplate, error) {
+	var t headerTemplate
+	last := 0
+	for _, m := range config.HeaderVariable.FindAllStringSubmatchIndex(s, -1) {
+		name := s[m[2]:m[3]]
+		if !config.KnownHeaderVariable(name) {
+			return nil, fmt.Errorf("unknown variable {%s}", name)
+		}
+		if m[0] > last {
+			t = append(t, headerSegment{literal: s[last:m[0]]})
+		}
+		t = append(t, headerSegment{variable: name})
+		last = m[1]
+	}
+	if last < len(s) {
+		t = append(t, headerSegment{literal: s[last:]})
+	}
+	return t, nil
+}
+
+func (t headerTemplate) uses(variable string) bool {
+	return slices.ContainsFunc(t, func(seg headerSegment) bool { return seg.variable == variable })
+}
+
+func (t headerTemplate) render(vars headerVars) string {
+	switch {
+	case len(t) == 0:
+		return ""
+	case len(t) == 1 && t[0].variable == "":
+		return t[0].literal
+	}
+
+	var b strings.Builder
+	for _, seg := range t {
+		if seg.variable == "" {
+			b.WriteString(seg.literal)
+		} else {
+			b.WriteString(vars.lookup(seg.variable))
+		}
+	}
+	return b.String()
+}
+
+/*
+headerVars resolves template variables for one proxied request. The
+exchange is optional so rules can be applied outside the reverse proxy.
+target is the upstream the request is sent to, which differs from the
+exchange's target for hedges still racing the first attempt.
+*/
+type headerVars struct {
+	req    *http.Request
+	rp     *routeProxy
+	ex     *exchange
+	target string
+}
+
+func (v headerVars) lookup(name string) string {
+	switch name {
+	case "client_ip":
+		return clientip.FromRequest(v.req)
+	case "route":
+		if v.rp.route.Name != "" {
+			return v.rp.route.Name
+		}
+		return v.rp.route.Path
+	case "path":
+		return v.rp.route.Path
+	case "request_id":
+		if v.ex == nil {
+			return v.req.Header.Get(requestIDHeader)
+		}
+		return v.ex.id()
+	case "method":
+		return v.req.Method
+	case "host":
+		return v.req.Host
+	case "upstream":
+		return v.target
+	}
+	if param, ok := strings.CutPrefix(name, "param."); ok && v.ex != nil {
+		return v.ex.params[param]
+	}
+	return ""
+}
+
+/*
+id returns the request ID of the exchange, taken from the incoming
+X-Request-ID header or generated on first use.
+*/
+func (ex *exchange) id() string {
+	if ex.requestID == "" {
+		ex.requestID = newRequestID()
+	}
+	return ex.requestID
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestHeaderRulesApply(t *testing.T) {
+	rules, err := newHeaderRules(&config.HeaderRules{
+		Remove: []string{"X-Internal"},
+		Rename: map[string]string{"X-Old": "X-New"},
+		Set:    map[string]string{"X-Route": "{route} via {method}", "X-Static": "on"},
+		Add:    map[string]string{"Via": "gothrottle"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create header rules: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/items", nil)
+	h := http.Header{}
+	h.Set("X-Internal", "secret")
+	h.Add("X-Old", "a")
+	h.Add("X-Old", "b")
+	h.Set("X-Static", "off")
+	h.Set("Via", "1.1 edge")
+
+	rp := &routeProxy{route: config.Route{Name: "items", Path: "/api"}}
+	rules.apply(h, headerVars{req: req, rp: rp})
+
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"X-Internal", nil},
+		{"X-Old", nil},
+		{"X-New", []string{"a", "b"}},
+		{"X-Route", []string{"items via POST"}},
+		{"X-Static", []string{"on"}},
+		{"Via", []string{"1.1 edge", "gothrottle"}},
+	}
+
+	for _, tt := range tests {
+		got := h.Values(tt.name)
+		if len(got) != len(tt.expected) {
+			t.Errorf("Expected %s to be %v, got %v", tt.name, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("Expected %s to be %v, got %v", tt.name, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestParseHeaderTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectError bool
+	}{
+		{"literal", "plain", "plain", false},
+		{"empty", "", "", false},
+		{"variables", "{client_ip}:{path}", "203.0.113.7:/api", false},
+		{"route falls back to path", "route={route}", "route=/api", false},
+		{"unmatched brace", "{client_ip", "{client_ip", false},
+		{"unknown variable", "{secret}", "", true},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req = req.WithContext(clientip.WithIP(req.Context(), "203.0.113.7"))
+	rp := &routeProxy{route: config.Route{Path: "/api"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseHeaderTemplate(tt.template)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := tmpl.render(headerVars{req: req, rp: rp}); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandleHeaderRules(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("X-Powered-By", "PHP/8.3")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Name:   "users",
+		Path:   "/api",
+		Target: backend.URL,
+		RequestHeaders: &config.HeaderRules{
+			Set:    map[string]string{"X-Request-ID": "{request_id}", "X-Route": "{route}"},
+			Remove: []string{"Cookie"},
+		},
+		ResponseHeaders: &config.HeaderRules{
+			Set:    map[string]string{"X-Request-ID": "{request_id}"},
+			Remove: []string{"Server", "X-Powered-By"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	serve := func(requestID string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		c.Request.Header.Set("Cookie", "session=abc")
+		if requestID != "" {
+			c.Request.Header.Set("X-Request-ID", requestID)
+		}
+		handler.Handle(c)
+		return rec
+	}
+
+	rec := serve("")
+	id := received.Get("X-Request-ID")
+	if len(id) != 32 {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != id {
+		t.Errorf("Expected response request ID %q, got %q", id, got)
+	}
+	if got := received.Get("X-Route"); got != "users" {
+		t.Errorf("Expected X-Route users, got %q", got)
+	}
+	if got := received.Get("Cookie"); got != "" {
+		t.Errorf("Expected Cookie to be removed, got %q", got)
+	}
+	if rec.Header().Get("Server") != "" || rec.Header().Get("X-Powered-By") != "" {
+		t.Errorf("Expected internal response headers to be stripped, got %v", rec.Header())
+	}
+
+	serve("client-id")
+	if got := received.Get("X-Request-ID"); got != "client-id" {
+		t.Errorf("Expected incoming request ID to be kept, got %q", got)
+	}
+}
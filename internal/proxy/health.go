@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+healthChecker actively probes the upstreams of a route and flips their
+health in the balancer once a run of consecutive results crosses the
+configured threshold, so a single slow probe does not take a target out.
+*/
+type healthChecker struct {
+	cfg      config.HealthCheck
+	route    string
+	balancer *Balancer
+	client   *http.Client
+	probes   map[string]*url.URL
+	mu       sync.Mutex
+	state    map[string]*probeState
+}
+
+type probeState struct {
+	successes int
+	failures  int
+}
+
+func newHealthChecker(cfg *config.HealthCheck, route string, balancer *Balancer, targets map[string]*url.URL) *healthChecker {
+	if cfg == nil {
+		return nil
+	}
+
+	hc := &healthChecker{
+		cfg:      *cfg,
+		route:    route,
+		balancer: balancer,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		probes: make(map[string]*url.URL),
+		state:  make(map[string]*probeState),
+	}
+
+	for raw, target := range targets {
+		probe := *target
+		probe.Path = singleJoiningSlash(target.Path, cfg.Path)
+		probe.RawPath = ""
+		probe.RawQuery = ""
+		hc.probes[raw] = &probe
+		hc.state[raw] = &probeState{}
+	}
+
+	return hc
+}
+
+/*
+run probes every target immediately and then once per interval until ctx
+is cancelled.
+*/
+func (hc *healthChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(hc.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		hc.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *healthChecker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for target, probe := range hc.probes {
+		wg.Add(1)
+		go func(target string, probe *url.URL) {
+			defer wg.Done()
+			hc.record(target, hc.probe(ctx, probe))
+		}(target, probe)
+	}
+	wg.Wait()
+}
+
+func (hc *healthChecker) probe(ctx context.Context, probe *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "gothrottle-health-check")
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	if !hc.expected(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (hc *healthChecker) expected(status int) bool {
+	if len(hc.cfg.ExpectedStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, s := range hc.cfg.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (hc *healthChecker) record(target string, err error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	st := hc.state[target]
+	healthy := hc.balancer.Healthy(target)
+
+	if err == nil {
+		st.successes++
+		st.failures = 0
+		if !healthy && st.successes >= hc.cfg.HealthyThreshold {
+			hc.balancer.SetHealthy(target, true)
+			log.Printf("Health check: route %s target %s is healthy", hc.route, target)
+		}
+		return
+	}
+
+	st.failures++
+	st.successes = 0
+	if healthy && st.failures >= hc.cfg.UnhealthyThreshold {
+		hc.balancer.SetHealthy(target, false)
+		log.Printf("Health check: route %s target %s is unhealthy: %v", hc.route, target, err)
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	balancer := NewBalancer([]string{"http://a", "http://b"})
+	hc := &healthChecker{
+		cfg:      config.HealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 3},
+		route:    "/api",
+		balancer: balancer,
+		state:    map[string]*probeState{"http://a": {}, "http://b": {}},
+	}
+
+	failure := errors.New("connection refused")
+
+	hc.record("http://a", failure)
+	hc.record("http://a", failure)
+	if !balancer.Healthy("http://a") {
+		t.Error("Expected target to stay healthy below the unhealthy threshold")
+	}
+
+	hc.record("http://a", failure)
+	if balancer.Healthy("http://a") {
+		t.Error("Expected target to be unhealthy after 3 failures")
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := balancer.Next(); got != "http://b" {
+			t.Errorf("Expected unhealthy target to be skipped, got %s", got)
+		}
+	}
+
+	hc.record("http://a", nil)
+	if balancer.Healthy("http://a") {
+		t.Error("Expected target to stay unhealthy below the healthy threshold")
+	}
+
+	hc.record("http://a", nil)
+	if !balancer.Healthy("http://a") {
+		t.Error("Expected target to recover after 2 successes")
+	}
+}
+
+func TestHealthCheckerExpectedStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []int
+		status   int
+		healthy  bool
+	}{
+		{"default accepts 2xx", nil, http.StatusNoContent, true},
+		{"default rejects 5xx", nil, http.StatusServiceUnavailable, false},
+		{"default rejects 3xx", nil, http.StatusFound, false},
+		{"explicit list", []int{200, 429}, http.StatusTooManyRequests, true},
+		{"explicit list rejects others", []int{200}, http.StatusNoContent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &healthChecker{cfg: config.HealthCheck{ExpectedStatus: tt.expected}}
+			if got := hc.expected(tt.status); got != tt.healthy {
+				t.Errorf("Expected %v for status %d, got %v", tt.healthy, tt.status, got)
+			}
+		})
+	}
+}
+
+func TestHandleHealthChecks(t *testing.T) {
+	var down atomic.Bool
+	var probed atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/base/healthz" {
+			probed.Add(1)
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path:   "/api",
+		Target: backend.URL + "/base",
+		HealthCheck: &config.HealthCheck{
+			Path:               "/healthz",
+			Interval:           10 * time.Millisecond,
+			Timeout:            10 * time.Millisecond,
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 1,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	down.Store(true)
+	handler.StartHealthChecks(ctx)
+
+	waitFor(t, func() bool { return !handler.Balancer("/api").Healthy(backend.URL + "/base") })
+
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	handler.Handle(c)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with no healthy upstream, got %d", rec.Code)
+	}
+
+	down.Store(false)
+	waitFor(t, func() bool { return handler.Balancer("/api").Healthy(backend.URL + "/base") })
+
+	if probed.Load() == 0 {
+		t.Error("Expected probes to hit the configured health path")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
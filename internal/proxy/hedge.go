@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+const (
+	// hedgeSamples is the number of recent response times kept to estimate
+	// the hedge delay percentile.
+	hedgeSamples = 1024
+
+	// hedgeMinSamples is the number of samples needed before the percentile
+	// replaces the configured minimum delay.
+	hedgeMinSamples = 20
+
+	// hedgeRefresh bounds how often the percentile is recomputed.
+	hedgeRefresh = time.Second
+)
+
+/*
+hedgePolicy tracks recent upstream response times of a route and derives
+the delay after which a slow request is hedged.
+*/
+type hedgePolicy struct {
+	cfg        config.Hedging
+	mu         sync.Mutex
+	samples    []time.Duration
+	next       int
+	cached     time.Duration
+	computedAt time.Time
+}
+
+func newHedgePolicy(cfg *config.Hedging) *hedgePolicy {
+	if cfg == nil || cfg.MaxHedges < 1 {
+		return nil
+	}
+	return &hedgePolicy{
+		cfg:     *cfg,
+		samples: make([]time.Duration, 0, hedgeSamples),
+		cached:  cfg.MinDelay,
+	}
+}
+
+/*
+eligible reports whether the request may be hedged: only bodiless GET and
+HEAD requests are safe to send twice, and protocol upgrades must not open
+two connections.
+*/
+func (h *hedgePolicy) eligible(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.ContentLength == 0 && !isUpgrade(req)
+}
+
+func (h *hedgePolicy) observe(rtt time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, rtt)
+	} else {
+		h.samples[h.next] = rtt
+		h.next = (h.next + 1) % hedgeSamples
+	}
+}
+
+/*
+delay returns the configured percentile of recent response times, never
+less than the minimum delay.
+*/
+func (h *hedgePolicy) delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeMinSamples || time.Since(h.computedAt) < hedgeRefresh {
+		return h.cached
+	}
+
+	sorted := slices.Clone(h.samples)
+	slices.Sort(sorted)
+	p := sorted[int(float64(len(sorted)-1)*h.cfg.Percentile/100)]
+
+	h.cached = max(p, h.cfg.MinDelay)
+	h.computedAt = time.Now()
+	return h.cached
+}
+
+type hedgeResult struct {
+	target string
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+/*
+hedged sends the request to the exchange's target and, each time the hedge
+delay passes without a response, a duplicate to another target. The first
+successful response wins and the other attempts are cancelled. If every
+attempt fails the last failure is returned. It also returns the targets it
+sent the request to, so retries can avoid them.
+*/
+func (t *upstreamTransport) hedged(req *http.Request, ex *exchange) (*http.Response, []string, error) {
+	hedge := t.rp.hedge
+	results := make(chan hedgeResult, hedge.cfg.MaxHedges+1)
+	cancels := make(map[string]context.CancelFunc)
+
+	launch := func(r *http.Request, target string) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels[target] = cancel
+		go func() {
+			resp, err := t.attempt(r.WithContext(ctx), target)
+			results <- hedgeResult{target: target, resp: resp, err: err, cancel: cancel}
+		}()
+	}
+
+	launch(req, ex.target)
+	tried := []string{ex.target}
+	pending := 1
+
+	timer := time.NewTimer(hedge.delay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if len(tried) > hedge.cfg.MaxHedges {
+				continue
+			}
+			next := t.rp.balancer.PickOther(tried)
+			if next == "" || !t.rp.begin(next) {
+				continue
+			}
+			tried = append(tried, next)
+			launch(t.rp.cloneFor(req, ex, next), next)
+			pending++
+			timer.Reset(hedge.delay())
+
+		case r := <-results:
+			pending--
+			failed := r.err != nil || r.resp.StatusCode >= http.StatusInternalServerError
+			if failed && pending > 0 {
+				if r.resp != nil {
+					r.resp.Body.Close()
+				}
+				r.cancel()
+				t.rp.finish(r.target, req.Context().Err() == nil, true)
+				continue
+			}
+
+			// The winner is released by serve once its body has been relayed
+			ex.target = r.target
+			if pending > 0 {
+				for target, cancel := range cancels {
+					if target != r.target {
+						cancel()
+					}
+				}
+				go t.drainHedges(results, pending)
+			}
+
+			if r.err != nil {
+				r.cancel()
+				return nil, tried, r.err
+			}
+			r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: r.cancel}
+			return r.resp, tried, nil
+		}
+	}
+}
+
+/*
+drainHedges collects the attempts that lost the race and releases them
+without reporting an outcome, since they were cancelled by the proxy.
+*/
+func (t *upstreamTransport) drainHedges(results <-chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		r := <-results
+		if r.resp != nil {
+			io.Copy(io.Discard, io.LimitReader(r.resp.Body, 4096))
+			r.resp.Body.Close()
+		}
+		r.cancel()
+		t.rp.finish(r.target, false, false)
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestHedgePolicyDelay(t *testing.T) {
+	h := newHedgePolicy(&config.Hedging{Percentile: 90, MinDelay: 5 * time.Millisecond, MaxHedges: 1})
+
+	if d := h.delay(); d != 5*time.Millisecond {
+		t.Errorf("Expected min delay before enough samples, got %v", d)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := h.delay(); d != 90*time.Millisecond {
+		t.Errorf("Expected p90 of 1..100ms to be 90ms, got %v", d)
+	}
+
+	fast := newHedgePolicy(&config.Hedging{Percentile: 50, MinDelay: 20 * time.Millisecond, MaxHedges: 1})
+	for i := 0; i < 50; i++ {
+		fast.observe(time.Millisecond)
+	}
+	if d := fast.delay(); d != 20*time.Millisecond {
+		t.Errorf("Expected delay never below min delay, got %v", d)
+	}
+}
+
+func TestHandleHedgedRequest(t *testing.T) {
+	var cancelled atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			cancelled.Add(1)
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path: "/api",
+		Targets: []config.Upstream{
+			{URL: slow.URL, Weight: 1},
+			{URL: fast.URL, Weight: 1},
+		},
+		Hedging: &config.Hedging{Percentile: 95, MinDelay: 20 * time.Millisecond, MaxHedges: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api", nil)
+		handler.Handle(c)
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "fast" {
+			t.Errorf("Expected hedged request to be answered by the fast target, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected hedging to avoid waiting on the slow target, took %v", elapsed)
+	}
+
+	balancer := handler.Balancer("/api")
+	waitFor(t, func() bool {
+		return cancelled.Load() > 0 && balancer.InFlight(slow.URL) == 0 && balancer.InFlight(fast.URL) == 0
+	})
+}
+
+func TestHedgingSkipsRequestsWithBody(t *testing.T) {
+	h := newHedgePolicy(&config.Hedging{Percentile: 95, MinDelay: time.Millisecond, MaxHedges: 1})
+
+	tests := []struct {
+		method   string
+		length   int64
+		eligible bool
+	}{
+		{http.MethodGet, 0, true},
+		{http.MethodHead, 0, true},
+		{http.MethodGet, 10, false},
+		{http.MethodPost, 0, false},
+		{http.MethodPut, 0, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.ContentLength = tt.length
+		if got := h.eligible(req); got != tt.eligible {
+			t.Errorf("%s with %d bytes: expected eligible %v, got %v", tt.method, tt.length, tt.eligible, got)
+		}
+	}
+}
+
+func TestHandleHedgedRequestRetry(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer slow.Close()
+
+	var hits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path: "/api",
+		Targets: []config.Upstream{
+			{URL: slow.URL, Weight: 1},
+			{URL: failing.URL, Weight: 1},
+		},
+		Hedging: &config.Hedging{Percentile: 95, MinDelay: 20 * time.Millisecond, MaxHedges: 1},
+		Retry:   &config.Retry{Attempts: 3, RetryOn: []string{"5xx"}, BudgetPercent: 100, MinRetriesPerSecond: 100},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	for i := 0; i < 4; i++ {
+		hits.Store(0)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api", nil)
+		handler.Handle(c)
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("Expected 502 once every target failed, got %d", rec.Code)
+		}
+		// A target that failed as a hedge must not be retried
+		if n := hits.Load(); n != 1 {
+			t.Errorf("Expected failing target to be tried once, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+routeMatcher holds the conditions a request must meet, beyond its path, to
+be served by a route. A matcher without conditions accepts every request.
+*/
+type routeMatcher struct {
+	hosts     []string
+	wildcards []string
+	methods   []string
+	headers   map[string]string
+	query     map[string]string
+	sources   []*net.IPNet
+}
+
+func newRouteMatcher(route config.Route) (*routeMatcher, error) {
+	m := &routeMatcher{
+		methods: route.Methods,
+		query:   route.Query,
+	}
+
+	for _, host := range route.Hosts {
+		host = strings.ToLower(host)
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			m.wildcards = append(m.wildcards, suffix)
+		} else {
+			m.hosts = append(m.hosts, host)
+		}
+	}
+
+	if len(route.Headers) > 0 {
+		m.headers = make(map[string]string, len(route.Headers))
+		for name, value := range route.Headers {
+			m.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	for _, cidr := range route.SourceCIDRs {
+		network, err := config.ParseNetwork(cidr)
+		if err != nil {
+			return nil, err
+		}
+		m.sources = append(m.sources, network)
+	}
+
+	return m, nil
+}
+
+/*
+match reports whether req meets every condition, along with how specific
+the host condition it met is: exact hosts beat wildcards, longer wildcard
+suffixes beat shorter ones, and routes without hosts score zero.
+*/
+func (m *routeMatcher) match(req *http.Request) (int, bool) {
+	hostScore, ok := m.matchHost(req.Host)
+	if !ok {
+		return 0, false
+	}
+
+	if len(m.methods) > 0 && !slices.Contains(m.methods, req.Method) {
+		return 0, false
+	}
+
+	for name, want := range m.headers {
+		if !matchValues(req.Header.Values(name), want) {
+			return 0, false
+		}
+	}
+
+	if len(m.query) > 0 {
+		query := req.URL.Query()
+		for name, want := range m.query {
+			if !matchValues(query[name], want) {
+				return 0, false
+			}
+		}
+	}
+
+	if len(m.sources) > 0 {
+		ip := net.ParseIP(clientip.FromRequest(req))
+		if ip == nil || !slices.ContainsFunc(m.sources, func(n *net.IPNet) bool { return n.Contains(ip) }) {
+			return 0, false
+		}
+	}
+
+	return hostScore, true
+}
+
+func (m *routeMatcher) matchHost(host string) (int, bool) {
+	if len(m.hosts) == 0 && len(m.wildcards) == 0 {
+		return 0, true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if slices.Contains(m.hosts, host) {
+		return math.MaxInt, true
+	}
+
+	best, ok := 0, false
+	for _, suffix := range m.wildcards {
+		if len(host) > len(suffix) && strings.HasSuffix(host, suffix) && len(suffix) >= best {
+			best, ok = len(suffix), true
+		}
+	}
+	return best, ok
+}
+
+func matchValues(values []string, want string) bool {
+	if want == "*" {
+		return len(values) > 0
+	}
+	return slices.Contains(values, want)
+}
+
+/*
+conditions counts the non-host conditions of the matcher, used to prefer
+the more specific of two routes with the same host and path.
+*/
+func (m *routeMatcher) conditions() int {
+	n := len(m.headers) + len(m.query)
+	if len(m.methods) > 0 {
+		n++
+	}
+	if len(m.sources) > 0 {
+		n++
+	}
+	return n
+}
+
+/*
+routeCandidate is a route whose path and conditions match a request.
+*/
+type routeCandidate struct {
+	rp        *routeProxy
+	hostScore int
+	path      pathMatch
+}
+
+/*
+outranks decides between two routes matching the same request. The more
+specific host wins first, then regex and glob routes over prefix routes,
+then the path with more literal characters, then the one with fewer
+parameters and wildcards, then the route with more conditions. Remaining
+ties go to the route configured first.
+*/
+func (a routeCandidate) outranks(b routeCandidate) bool {
+	switch {
+	case a.hostScore != b.hostScore:
+		return a.hostScore > b.hostScore
+	case a.path.pattern != b.path.pattern:
+		return a.path.pattern
+	case a.path.literal != b.path.literal:
+		return a.path.literal > b.path.literal
+	case a.path.dynamic != b.path.dynamic:
+		return a.path.dynamic < b.path.dynamic
+	case a.rp.matcher.conditions() != b.rp.matcher.conditions():
+		return a.rp.matcher.conditions() > b.rp.matcher.conditions()
+	}
+	return a.path.route < b.path.route
+}
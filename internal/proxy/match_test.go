@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestRouteMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    config.Route
+		prepare  func(*http.Request)
+		expected bool
+	}{
+		{"no conditions", config.Route{}, func(r *http.Request) {}, true},
+		{"exact host", config.Route{Hosts: []string{"api.example.com"}}, func(r *http.Request) { r.Host = "API.example.com:8080" }, true},
+		{"other host", config.Route{Hosts: []string{"api.example.com"}}, func(r *http.Request) { r.Host = "admin.example.com" }, false},
+		{"wildcard host", config.Route{Hosts: []string{"*.example.com"}}, func(r *http.Request) { r.Host = "a.b.example.com" }, true},
+		{"wildcard excludes apex", config.Route{Hosts: []string{"*.example.com"}}, func(r *http.Request) { r.Host = "example.com" }, false},
+		{"method", config.Route{Methods: []string{"POST"}}, func(r *http.Request) { r.Method = http.MethodPost }, true},
+		{"other method", config.Route{Methods: []string{"POST"}}, func(r *http.Request) {}, false},
+		{"header value", config.Route{Headers: map[string]string{"x-tier": "beta"}}, func(r *http.Request) { r.Header.Set("X-Tier", "beta") }, true},
+		{"header mismatch", config.Route{Headers: map[string]string{"X-Tier": "beta"}}, func(r *http.Request) { r.Header.Set("X-Tier", "stable") }, false},
+		{"header presence", config.Route{Headers: map[string]string{"Authorization": "*"}}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer x") }, true},
+		{"header missing", config.Route{Headers: map[string]string{"Authorization": "*"}}, func(r *http.Request) {}, false},
+		{"query value", config.Route{Query: map[string]string{"version": "2"}}, func(r *http.Request) { r.URL.RawQuery = "version=2" }, true},
+		{"query missing", config.Route{Query: map[string]string{"version": "*"}}, func(r *http.Request) {}, false},
+		{
+			"source cidr",
+			config.Route{SourceCIDRs: []string{"10.0.0.0/8"}},
+			func(r *http.Request) { *r = *r.WithContext(clientip.WithIP(r.Context(), "10.1.2.3")) },
+			true,
+		},
+		{"source outside cidr", config.Route{SourceCIDRs: []string{"10.0.0.0/8"}}, func(r *http.Request) {}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newRouteMatcher(tt.route)
+			if err != nil {
+				t.Fatalf("Failed to create matcher: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.prepare(req)
+			if _, ok := m.match(req); ok != tt.expected {
+				t.Errorf("Expected match %v, got %v", tt.expected, ok)
+			}
+		})
+	}
+}
+
+func TestHandleRoutePrecedence(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+
+	names := []string{"default", "api", "wildcard", "api-v2", "admin-internal"}
+	backends := make(map[string]string)
+	for _, name := range names {
+		backend := newBackend(name)
+		defer backend.Close()
+		backends[name] = backend.URL
+	}
+
+	handler, err := NewHandler([]config.Route{
+		{Path: "/api", Target: backends["default"]},
+		{Path: "/", Target: backends["api"], Hosts: []string{"api.example.com"}},
+		{Path: "/", Target: backends["wildcard"], Hosts: []string{"*.example.com"}},
+		{Path: "/", Target: backends["api-v2"], Hosts: []string{"api.example.com"}, Headers: map[string]string{"X-Version": "2"}},
+		{Path: "/", Target: backends["admin-internal"], Hosts: []string{"admin.example.com"}, SourceCIDRs: []string{"10.0.0.0/8"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		header   string
+		clientIP string
+		expected string
+	}{
+		{"host beats longer path", "api.example.com", "", "", "api"},
+		{"more conditions win", "api.example.com", "2", "", "api-v2"},
+		{"wildcard subdomain", "shop.example.com", "", "", "wildcard"},
+		{"source cidr", "admin.example.com", "", "10.0.0.5", "admin-internal"},
+		{"source cidr falls back to wildcard", "admin.example.com", "", "203.0.113.1", "wildcard"},
+		{"unknown host uses host-less route", "other.test", "", "", "default"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			c.Request.Host = tt.host
+			if tt.header != "" {
+				c.Request.Header.Set("X-Version", tt.header)
+			}
+			if tt.clientIP != "" {
+				c.Request = c.Request.WithContext(clientip.WithIP(c.Request.Context(), tt.clientIP))
+			}
+			handler.Handle(c)
+
+			if rec.Body.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/*
+WriteMetrics writes upstream circuit breaker metrics in the Prometheus text
+exposition format. Routes without a circuit breaker are omitted. Routes are
+labelled by name, or by their index in the configuration when unnamed, since
+several routes may share a path.
+*/
+func (h *Handler) WriteMetrics(w io.Writer) error {
+	type sample struct {
+		labels string
+		stats  circuitStats
+	}
+
+	var samples []sample
+	for i, rp := range h.proxies {
+		if rp.breaker == nil {
+			continue
+		}
+		route := rp.route.Name
+		if route == "" {
+			route = strconv.Itoa(i)
+		}
+		for _, target := range rp.balancer.Targets() {
+			stats, ok := rp.breaker.stats(target)
+			if !ok {
+				continue
+			}
+			labels := fmt.Sprintf(`route="%s",target="%s"`, labelEscaper.Replace(route), labelEscaper.Replace(target))
+			samples = append(samples, sample{labels: labels, stats: stats})
+		}
+	}
+
+	var b strings.Builder
+
+	b.WriteString("# HELP gothrottle_upstream_circuit_state Circuit breaker state of the upstream (0 closed, 1 open, 2 half-open).\n")
+	b.WriteString("# TYPE gothrottle_upstream_circuit_state gauge\n")
+	for _, s := range samples {
+		fmt.Fprintf(&b, "gothrottle_upstream_circuit_state{%s} %d\n", s.labels, s.stats.state)
+	}
+
+	b.WriteString("# HELP gothrottle_upstream_circuit_transitions_total Circuit breaker state transitions by new state.\n")
+	b.WriteString("# TYPE gothrottle_upstream_circuit_transitions_total counter\n")
+	for _, s := range samples {
+		for _, state := range []circuitState{circuitClosed, circuitOpen, circuitHalfOpen} {
+			fmt.Fprintf(&b, "gothrottle_upstream_circuit_transitions_total{%s,state=\"%s\"} %d\n", s.labels, state, s.stats.transitions[state])
+		}
+	}
+
+	b.WriteString("# HELP gothrottle_upstream_circuit_rejected_total Requests rejected because the circuit was open.\n")
+	b.WriteString("# TYPE gothrottle_upstream_circuit_rejected_total counter\n")
+	for _, s := range samples {
+		fmt.Fprintf(&b, "gothrottle_upstream_circuit_rejected_total{%s} %d\n", s.labels, s.stats.rejected)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
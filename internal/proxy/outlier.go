@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+outlierDetector watches live traffic and ejects targets that fail several
+requests in a row. This catches partial failures a health endpoint never
+shows, such as a single broken handler or a wedged connection pool.
+*/
+type outlierDetector struct {
+	cfg      config.OutlierDetection
+	route    string
+	balancer *Balancer
+	mu       sync.Mutex
+	state    map[string]*outlierState
+}
+
+type outlierState struct {
+	consecutive  int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+func newOutlierDetector(cfg *config.OutlierDetection, route string, balancer *Balancer) *outlierDetector {
+	if cfg == nil {
+		return nil
+	}
+
+	od := &outlierDetector{
+		cfg:      *cfg,
+		route:    route,
+		balancer: balancer,
+		state:    make(map[string]*outlierState),
+	}
+	for _, t := range balancer.Targets() {
+		od.state[t] = &outlierState{}
+	}
+	return od
+}
+
+/*
+observe records the outcome of a request to target. A failure is a 5xx
+response or a transport error; anything else resets the failure streak.
+*/
+func (od *outlierDetector) observe(target string, failed bool) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	st := od.state[target]
+	if st == nil {
+		return
+	}
+
+	if !failed {
+		st.consecutive = 0
+		return
+	}
+
+	st.consecutive++
+	if st.consecutive < od.cfg.Consecutive5xx {
+		return
+	}
+
+	now := time.Now()
+	if now.Before(st.ejectedUntil) || od.ejectedCount(now) >= od.maxEjected() {
+		return
+	}
+
+	// A target that behaved for a full max ejection window starts over
+	if now.Sub(st.ejectedUntil) > od.cfg.MaxEjectionTime {
+		st.ejections = 0
+	}
+	st.ejections++
+	st.consecutive = 0
+
+	duration := od.cfg.BaseEjectionTime << min(st.ejections-1, 30)
+	if duration > od.cfg.MaxEjectionTime || duration <= 0 {
+		duration = od.cfg.MaxEjectionTime
+	}
+	st.ejectedUntil = now.Add(duration)
+	od.balancer.Eject(target, st.ejectedUntil)
+
+	log.Printf("Outlier detection: route %s ejected target %s for %v (ejection #%d)", od.route, target, duration, st.ejections)
+}
+
+func (od *outlierDetector) ejectedCount(now time.Time) int {
+	n := 0
+	for _, st := range od.state {
+		if now.Before(st.ejectedUntil) {
+			n++
+		}
+	}
+	return n
+}
+
+func (od *outlierDetector) maxEjected() int {
+	return len(od.state) * od.cfg.MaxEjectionPercent / 100
+}
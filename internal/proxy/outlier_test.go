@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func newTestOutlierDetector(targets []string, percent int) (*outlierDetector, *Balancer) {
+	balancer := NewBalancer(targets)
+	od := newOutlierDetector(&config.OutlierDetection{
+		Consecutive5xx:     3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    5 * time.Minute,
+		MaxEjectionPercent: percent,
+	}, "/api", balancer)
+	return od, balancer
+}
+
+func TestOutlierDetectorEjectsAfterConsecutiveFailures(t *testing.T) {
+	od, balancer := newTestOutlierDetector([]string{"http://a", "http://b"}, 50)
+
+	od.observe("http://a", true)
+	od.observe("http://a", true)
+	od.observe("http://a", false)
+	od.observe("http://a", true)
+	od.observe("http://a", true)
+	if balancer.Ejected("http://a") {
+		t.Error("Expected a success to reset the failure streak")
+	}
+
+	od.observe("http://a", true)
+	if !balancer.Ejected("http://a") {
+		t.Fatal("Expected target to be ejected after 3 consecutive failures")
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := balancer.Next(); got != "http://b" {
+			t.Errorf("Expected ejected target to be skipped, got %s", got)
+		}
+	}
+}
+
+func TestOutlierDetectorEjectionBackoff(t *testing.T) {
+	od, _ := newTestOutlierDetector([]string{"http://a", "http://b"}, 50)
+	st := od.state["http://a"]
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+	for i, want := range expected {
+		for j := 0; j < 3; j++ {
+			od.observe("http://a", true)
+		}
+		got := time.Until(st.ejectedUntil).Round(time.Second)
+		if got != want {
+			t.Errorf("Ejection %d: expected %v, got %v", i+1, want, got)
+		}
+
+		// Expire the ejection without resetting the history
+		st.ejectedUntil = time.Now()
+	}
+}
+
+func TestOutlierDetectorMaxEjectionPercent(t *testing.T) {
+	od, balancer := newTestOutlierDetector([]string{"http://a", "http://b", "http://c", "http://d"}, 50)
+
+	for _, target := range []string{"http://a", "http://b", "http://c"} {
+		for i := 0; i < 3; i++ {
+			od.observe(target, true)
+		}
+	}
+
+	ejected := 0
+	for _, target := range balancer.Targets() {
+		if balancer.Ejected(target) {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("Expected at most 2 of 4 targets ejected, got %d", ejected)
+	}
+
+	single, balancer := newTestOutlierDetector([]string{"http://a"}, 50)
+	for i := 0; i < 3; i++ {
+		single.observe("http://a", true)
+	}
+	if balancer.Ejected("http://a") {
+		t.Error("Expected the only target of a route never to be ejected at 50%")
+	}
+}
+
+func TestHandleOutlierDetection(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path: "/api",
+		Targets: []config.Upstream{
+			{URL: broken.URL, Weight: 1},
+			{URL: healthy.URL, Weight: 1},
+		},
+		OutlierDetection: &config.OutlierDetection{
+			Consecutive5xx:     2,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionTime:    time.Minute,
+			MaxEjectionPercent: 50,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api", nil)
+		handler.Handle(c)
+		return rec.Code
+	}
+
+	for i := 0; i < 4; i++ {
+		serve()
+	}
+
+	if !handler.Balancer("/api").Ejected(broken.URL) {
+		t.Fatal("Expected backend returning 500s to be ejected")
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := serve(); code != http.StatusOK {
+			t.Errorf("Expected traffic to avoid ejected target, got %d", code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+newRoutePattern compiles the path of a regex or glob route. Prefix routes
+live in the radix tree instead and have no pattern.
+*/
+func newRoutePattern(route config.Route) (*regexp.Regexp, error) {
+	switch route.Match {
+	case "regex":
+		return regexp.Compile(route.Path)
+	case "glob":
+		return regexp.Compile(globToRegexp(route.Path))
+	}
+	return nil, nil
+}
+
+/*
+globToRegexp translates a glob into an anchored regular expression. "*"
+matches within one segment, "**" across segments and "?" one character
+other than a slash. Each "*" and "**" becomes a numbered capture group.
+*/
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString("(.*)")
+				i++
+			} else {
+				b.WriteString("([^/]*)")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+/*
+matchPattern matches path against a route pattern and returns its captures,
+keyed by group name or, for unnamed groups, by index.
+*/
+func matchPattern(pattern *regexp.Regexp, path string) (map[string]string, bool) {
+	groups := pattern.FindStringSubmatch(path)
+	if groups == nil {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, name := range pattern.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string, len(groups)-1)
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		params[name] = groups[i]
+	}
+	return params, true
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    config.Route
+		path     string
+		matches  bool
+		expected map[string]string
+	}{
+		{
+			"regex",
+			config.Route{Match: "regex", Path: `^/v[0-9]+/legacy/.*\.php$`},
+			"/v3/legacy/admin/index.php", true, nil,
+		},
+		{
+			"regex mismatch",
+			config.Route{Match: "regex", Path: `^/v[0-9]+/legacy/.*\.php$`},
+			"/v3/legacy/index.html", false, nil,
+		},
+		{
+			"regex named captures",
+			config.Route{Match: "regex", Path: `^/shop/(?P<category>[^/]+)/(\d+)$`},
+			"/shop/books/42", true, map[string]string{"category": "books", "2": "42"},
+		},
+		{
+			"glob single segment",
+			config.Route{Match: "glob", Path: "/assets/*.css"},
+			"/assets/site.css", true, map[string]string{"1": "site"},
+		},
+		{
+			"glob does not cross segments",
+			config.Route{Match: "glob", Path: "/assets/*.css"},
+			"/assets/theme/site.css", false, nil,
+		},
+		{
+			"glob double star",
+			config.Route{Match: "glob", Path: "/docs/**.md"},
+			"/docs/guide/intro.md", true, map[string]string{"1": "guide/intro"},
+		},
+		{
+			"glob question mark and literal dot",
+			config.Route{Match: "glob", Path: "/v?/a.b"},
+			"/v1/axb", false, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := newRoutePattern(tt.route)
+			if err != nil {
+				t.Fatalf("Failed to compile pattern: %v", err)
+			}
+
+			params, ok := matchPattern(pattern, tt.path)
+			if ok != tt.matches {
+				t.Fatalf("Expected match %v, got %v", tt.matches, ok)
+			}
+			for k, v := range tt.expected {
+				if params[k] != v {
+					t.Errorf("Expected capture %s=%s, got %s", k, v, params[k])
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePatternRoutes(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.Path + " " + r.Header.Get("X-Category")))
+		}))
+	}
+	site := newBackend("site")
+	defer site.Close()
+	legacy := newBackend("legacy")
+	defer legacy.Close()
+
+	handler, err := NewHandler([]config.Route{
+		{Path: "/", Target: site.URL},
+		{
+			Match:          "regex",
+			Path:           `^/v[0-9]+/(?P<category>[^/]+)/(?P<page>.*)\.php$`,
+			Target:         legacy.URL,
+			Rewrite:        &config.Rewrite{Replacement: "/legacy/${category}/${page}"},
+			RequestHeaders: &config.HeaderRules{Set: map[string]string{"X-Category": "{param.category}"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/v2/books/list.php", "legacy /legacy/books/list books"},
+		{"/v2/books/list.html", "site /v2/books/list.html "},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+			c.Request = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			handler.Handle(c)
+
+			if rec.Body.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rec.Body.String())
+			}
+		})
+	}
+}
@@ -1,74 +1,252 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/clientip"
 	"github.com/smartcraze/gothrottle/internal/config"
 )
 
 /*
 Handler manages reverse proxy functionality with path-based routing.
 It matches incoming request paths to configured upstream targets using
-longest prefix matching and forwards requests accordingly.
+longest prefix matching on a radix tree or, for regex and glob routes, by
+pattern, optionally narrowed by host, method, headers, query parameters and
+client address, and forwards requests accordingly.
 */
 type Handler struct {
-	proxies map[string]*httputil.ReverseProxy
-	routes  []config.Route
+	proxies  []*routeProxy
+	routes   []config.Route
+	tree     *routeTree
+	patterns []int
+}
+
+/*
+routeProxy bundles everything needed to serve one route: the reverse proxy,
+the balancer choosing among its upstreams, optional sticky sessions, health
+checks, outlier detection, circuit breakers, retries, hedging, WebSocket and
+bandwidth limits.
+*/
+type routeProxy struct {
+	route    config.Route
+	pattern  *regexp.Regexp
+	matcher  *routeMatcher
+	proxy    *httputil.ReverseProxy
+	balancer *Balancer
+	targets  map[string]*url.URL
+	rewriter *pathRewriter
+	reqHdrs  *headerRules
+	respHdrs *headerRules
+	sticky   *stickySessions
+	health   *healthChecker
+	outlier  *outlierDetector
+	breaker  *circuitBreaker
+	retry    *retryPolicy
+	hedge    *hedgePolicy
+	ws       *websocketLimiter
+	limiter  *bandwidthLimiter
+}
+
+type exchangeKey struct{}
+
+/*
+exchange carries one proxied request through the reverse proxy hooks and the
+upstream transport: the target currently serving it, the original URL and
+buffered body needed to replay it elsewhere, the path parameters and request
+ID available to header templates, the deadlines to lift if the response
+turns out to be a stream, and the outcome
+of the final attempt so serve can report it once the response has been
+relayed.
+*/
+type exchange struct {
+	target     string
+	inbound    url.URL
+	params     map[string]string
+	requestID  string
+	header     http.Header
+	writer     http.ResponseWriter
+	deadline   *deadline
+	body       []byte
+	replayable bool
+	observed   bool
+	failed     bool
 }
 
 func NewHandler(routes []config.Route) (*Handler, error) {
+	return NewHandlerWithBandwidth(routes, config.Bandwidth{})
+}
+
+/*
+NewHandlerWithBandwidth builds a handler whose routes without their own
+bandwidth block share one set of per-client buckets limited by bandwidth, so
+the global limit holds across every such route a client uses.
+*/
+func NewHandlerWithBandwidth(routes []config.Route, bandwidth config.Bandwidth) (*Handler, error) {
 	handler := &Handler{
-		proxies: make(map[string]*httputil.ReverseProxy),
-		routes:  routes,
+		routes: routes,
+		tree:   newRouteTree(),
 	}
+	shared := newBandwidthLimiter(&bandwidth)
 
-	for _, route := range routes {
-		targetURL, err := url.Parse(route.Target)
+	for i, route := range routes {
+		rp, err := newRouteProxy(route)
 		if err != nil {
-			return nil, fmt.Errorf("invalid target URL for path %s: %w", route.Path, err)
+			return nil, err
 		}
-
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
+		if route.Bandwidth == nil {
+			rp.limiter = shared
+		}
+		if rp.pattern != nil {
+			handler.patterns = append(handler.patterns, i)
+		} else if err := handler.tree.insert(route.Path, i); err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
 		}
+		handler.proxies = append(handler.proxies, rp)
+	}
 
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			http.Error(w, fmt.Sprintf("Bad Gateway: %v", err), http.StatusBadGateway)
+	return handler, nil
+}
+
+func newRouteProxy(route config.Route) (*routeProxy, error) {
+	upstreams := route.Upstreams()
+	balancer, err := NewBalancerFromConfig(route.LoadBalancing, upstreams)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Path, err)
+	}
+
+	rp := &routeProxy{
+		route:    route,
+		balancer: balancer,
+		targets:  make(map[string]*url.URL),
+		limiter:  newBandwidthLimiter(route.Bandwidth),
+	}
+
+	for _, upstream := range upstreams {
+		targetURL, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URL for path %s: %w", route.Path, err)
 		}
+		rp.targets[upstream.URL] = targetURL
+	}
 
-		handler.proxies[route.Path] = proxy
+	rp.pattern, err = newRoutePattern(route)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Path, err)
 	}
 
-	return handler, nil
+	rp.matcher, err = newRouteMatcher(route)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Path, err)
+	}
+
+	rp.rewriter, err = newPathRewriter(route, rp.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: rewrite: %w", route.Path, err)
+	}
+
+	rp.reqHdrs, err = newHeaderRules(route.RequestHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: request_headers: %w", route.Path, err)
+	}
+	rp.respHdrs, err = newHeaderRules(route.ResponseHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: response_headers: %w", route.Path, err)
+	}
+
+	rp.sticky, err = newStickySessions(route.StickySession, route.Path, route.UpstreamURLs())
+	if err != nil {
+		return nil, fmt.Errorf("route %s: sticky session: %w", route.Path, err)
+	}
+
+	rp.health = newHealthChecker(route.HealthCheck, route.Path, balancer, rp.targets)
+	rp.outlier = newOutlierDetector(route.OutlierDetection, route.Path, balancer)
+	rp.breaker = newCircuitBreaker(route.CircuitBreaker, route.Path, balancer)
+	rp.retry = newRetryPolicy(route.Retry)
+	rp.hedge = newHedgePolicy(route.Hedging)
+	rp.ws = newWebSocketLimiter(route.WebSocket)
+
+	rp.proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			ex, ok := req.Context().Value(exchangeKey{}).(*exchange)
+			var target string
+			if ok {
+				target = ex.target
+				rp.direct(req, target)
+			}
+			// Forwarding headers are added once here rather than in
+			// direct, since retries and hedges clone the edited headers
+			setForwardedHeaders(req)
+			if ok && rp.reqHdrs != nil && rp.reqHdrs.perTarget {
+				ex.header = req.Header.Clone()
+			}
+			rp.editRequestHeaders(req, ex, target)
+		},
+		Transport: &upstreamTransport{
+			base: newHTTPTransport(route.Transport),
+			rp:   rp,
+		},
+		FlushInterval: route.FlushInterval,
+		ModifyResponse: func(resp *http.Response) error {
+			rp.observe(resp.Request, resp.StatusCode >= http.StatusInternalServerError)
+			if ex, ok := resp.Request.Context().Value(exchangeKey{}).(*exchange); ok && rp.isStream(resp) {
+				ex.stream()
+			}
+			rp.editResponseHeaders(resp.Header, resp.Request)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if !errors.Is(err, context.Canceled) {
+				rp.observe(r, true)
+			}
+			rp.editResponseHeaders(w.Header(), r)
+			if isTimeout(err) {
+				http.Error(w, fmt.Sprintf("Gateway Timeout: %v", err), http.StatusGatewayTimeout)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Bad Gateway: %v", err), http.StatusBadGateway)
+		},
+	}
+
+	return rp, nil
 }
 
 /*
 Handle processes incoming requests using longest prefix matching to find
 the appropriate upstream target, then forwards the request via reverse proxy.
+When several routes match, routeCandidate.outranks picks the most specific.
 */
 func (h *Handler) Handle(c *gin.Context) {
 	requestPath := c.Request.URL.Path
-	var matchedRoute *config.Route
-	var matchedProxy *httputil.ReverseProxy
-
-	for i := range h.routes {
-		route := &h.routes[i]
-		if strings.HasPrefix(requestPath, route.Path) {
-			if matchedRoute == nil || len(route.Path) > len(matchedRoute.Path) {
-				matchedRoute = route
-				matchedProxy = h.proxies[route.Path]
-			}
+	var matched *routeCandidate
+
+	matches := h.tree.lookup(requestPath)
+	for _, idx := range h.patterns {
+		if params, ok := matchPattern(h.proxies[idx].pattern, requestPath); ok {
+			matches = append(matches, pathMatch{route: idx, pattern: true, params: params})
 		}
 	}
 
-	if matchedProxy == nil {
+	for _, m := range matches {
+		rp := h.proxies[m.route]
+		hostScore, ok := rp.matcher.match(c.Request)
+		if !ok {
+			continue
+		}
+		candidate := routeCandidate{rp: rp, hostScore: hostScore, path: m}
+		if matched == nil || candidate.outranks(*matched) {
+			matched = &candidate
+		}
+	}
+
+	if matched == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "no route found for path",
 			"path":  requestPath,
@@ -76,9 +254,290 @@ func (h *Handler) Handle(c *gin.Context) {
 		return
 	}
 
-	matchedProxy.ServeHTTP(c.Writer, c.Request)
+	matched.rp.serve(c, matched.path.params)
+}
+
+func (rp *routeProxy) serve(c *gin.Context, params map[string]string) {
+	defer recoverClientGone(c)
+
+	upgrade, websocket := isUpgrade(c.Request), isWebSocket(c.Request)
+	if websocket && rp.ws != nil {
+		client := clientip.FromRequest(c.Request)
+		if !rp.ws.acquire(client) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "too many websocket connections",
+				"path":  c.Request.URL.Path,
+			})
+			return
+		}
+		defer rp.ws.release(client)
+	}
+
+	target := rp.pick(c)
+	if target == "" && rp.breaker != nil && rp.breaker.reject() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "upstream circuit open",
+			"path":  c.Request.URL.Path,
+		})
+		return
+	}
+	if target == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "no upstream available",
+			"path":  c.Request.URL.Path,
+		})
+		return
+	}
+
+	if !rp.begin(target) {
+		target = rp.beginOther(target)
+	}
+	if target == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "upstream circuit open",
+			"path":  c.Request.URL.Path,
+		})
+		return
+	}
+
+	ex := &exchange{
+		target:    target,
+		inbound:   *c.Request.URL,
+		params:    params,
+		requestID: c.Request.Header.Get(requestIDHeader),
+	}
+	defer func() { rp.finish(ex.target, ex.observed, ex.failed) }()
+
+	ctx := context.WithValue(c.Request.Context(), exchangeKey{}, ex)
+	// The deadline would cut upgraded connections short
+	if rp.route.Transport.RequestTimeout > 0 && !upgrade {
+		var cancel context.CancelFunc
+		ctx, ex.deadline, cancel = withDeadline(ctx, rp.route.Transport.RequestTimeout)
+		defer cancel()
+	}
+
+	var w http.ResponseWriter = c.Writer
+	req := c.Request.WithContext(ctx)
+	if rp.limiter != nil {
+		w, req = rp.limiter.wrap(w, req)
+	}
+	if websocket && rp.ws != nil {
+		w = rp.ws.wrap(w, req)
+	}
+	ex.writer = w
+
+	if rp.retry != nil {
+		rp.retry.budget.request()
+		body, replayable, err := rp.retry.bufferBody(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "failed to read request body",
+				"path":  c.Request.URL.Path,
+			})
+			return
+		}
+		ex.body, ex.replayable = body, replayable
+	}
+
+	rp.proxy.ServeHTTP(w, req)
+}
+
+/*
+direct rewrites the path of an outgoing request for the upstream and points
+it at target.
+*/
+func (rp *routeProxy) direct(req *http.Request, target string) {
+	if rp.rewriter != nil {
+		rp.rewriter.apply(req.URL)
+	}
+	rewriteRequestURL(req, rp.targets[target])
+}
+
+/*
+editRequestHeaders applies the request header rules of the route to req,
+which is sent to target.
+*/
+func (rp *routeProxy) editRequestHeaders(req *http.Request, ex *exchange, target string) {
+	if rp.reqHdrs != nil {
+		rp.reqHdrs.apply(req.Header, headerVars{req: req, rp: rp, ex: ex, target: target})
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+/*
+editResponseHeaders applies the response header rules of the route to the
+headers about to be sent back for req.
+*/
+func (rp *routeProxy) editResponseHeaders(h http.Header, req *http.Request) {
+	if rp.respHdrs == nil {
+		return
+	}
+	vars := headerVars{req: req, rp: rp}
+	if ex, ok := req.Context().Value(exchangeKey{}).(*exchange); ok {
+		vars.ex, vars.target = ex, ex.target
+	}
+	rp.respHdrs.apply(h, vars)
+}
+
+/*
+observe records the outcome of the final upstream attempt in the exchange.
+*/
+func (rp *routeProxy) observe(req *http.Request, failed bool) {
+	if ex, ok := req.Context().Value(exchangeKey{}).(*exchange); ok {
+		ex.observed = true
+		ex.failed = failed
+	}
+}
+
+/*
+begin admits a request to target through its circuit breaker and counts it
+as in flight. Every successful begin must be paired with finish.
+*/
+func (rp *routeProxy) begin(target string) bool {
+	if rp.breaker != nil && !rp.breaker.allow(target) {
+		return false
+	}
+	rp.balancer.Acquire(target)
+	return true
+}
+
+/*
+beginOther admits the request to another target after begin refused the
+one it picked. A circuit whose open period just ended looks available to
+the balancer until a request claims its half-open trial, so concurrent
+requests can all pick it while only one of them gets in. It returns an
+empty string when no other target admits the request.
+*/
+func (rp *routeProxy) beginOther(refused string) string {
+	tried := []string{refused}
+	for {
+		target := rp.balancer.PickOther(tried)
+		if target == "" || rp.begin(target) {
+			return target
+		}
+		tried = append(tried, target)
+	}
+}
+
+/*
+finish releases target and feeds the outcome to the outlier detector and
+circuit breaker. Requests without an outcome, such as those cancelled by the
+client, say nothing about the upstream and only release a half-open trial.
+*/
+func (rp *routeProxy) finish(target string, observed, failed bool) {
+	rp.balancer.Release(target)
+
+	if !observed {
+		if rp.breaker != nil {
+			rp.breaker.cancel(target)
+		}
+		return
+	}
+
+	if rp.outlier != nil {
+		rp.outlier.observe(target, failed)
+	}
+	if rp.breaker != nil {
+		rp.breaker.record(target, failed)
+	}
+}
+
+/*
+pick honours a valid affinity cookie while its target is still available and
+otherwise asks the balancer, pinning the client to the new choice.
+*/
+func (rp *routeProxy) pick(c *gin.Context) string {
+	if rp.sticky == nil {
+		return rp.balancer.Pick(c.Request)
+	}
+
+	if target := rp.sticky.target(c.Request); target != "" && rp.balancer.Available(target) {
+		return target
+	}
+
+	target := rp.balancer.Pick(c.Request)
+	if target != "" {
+		http.SetCookie(c.Writer, rp.sticky.cookie(target))
+	}
+	return target
+}
+
+/*
+rewriteRequestURL points the outgoing request at target the same way
+httputil.NewSingleHostReverseProxy does, joining the target base path with
+the request path and merging query strings.
+*/
+func rewriteRequestURL(req *http.Request, target *url.URL) {
+	targetQuery := target.RawQuery
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path, req.URL.RawPath = joinURLPath(target, req.URL)
+	if targetQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = targetQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
+	}
+}
+
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+/*
+StartHealthChecks starts the active health checkers of all routes that have
+one configured. They run in the background until ctx is cancelled.
+*/
+func (h *Handler) StartHealthChecks(ctx context.Context) {
+	for _, rp := range h.proxies {
+		if rp.health != nil {
+			go rp.health.run(ctx)
+		}
+	}
 }
 
 func (h *Handler) GetRoutes() []config.Route {
 	return h.routes
 }
+
+/*
+Balancer returns the balancer of the route configured with path, allowing
+target weights to be adjusted while the proxy is running.
+*/
+func (h *Handler) Balancer(path string) *Balancer {
+	for _, rp := range h.proxies {
+		if rp.route.Path == path {
+			return rp.balancer
+		}
+	}
+	return nil
+}
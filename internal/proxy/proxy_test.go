@@ -3,7 +3,9 @@ package proxy
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/smartcraze/gothrottle/internal/config"
@@ -166,3 +168,249 @@ func TestHandleLongestPrefixMatch(t *testing.T) {
 		t.Errorf("Expected 'api', got %s", rec.Body.String())
 	}
 }
+
+func TestHandleBandwidthThrottling(t *testing.T) {
+	payload := strings.Repeat("x", 15000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	routes := []config.Route{
+		{Path: "/api", Target: server.URL, Bandwidth: &config.Bandwidth{Download: 10000}},
+	}
+
+	handler, err := NewHandler(routes)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	start := time.Now()
+
+	rec := httptest.NewRecorder()
+	w := &responseWriterWrapper{rec}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	handler.Handle(c)
+
+	if rec.Body.Len() != len(payload) {
+		t.Errorf("Expected %d bytes, got %d", len(payload), rec.Body.Len())
+	}
+
+	// 10000 bytes of burst, then 5000 bytes at 10000 B/s
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected download to be throttled, took %v", elapsed)
+	}
+}
+
+func TestHandleSharedBandwidth(t *testing.T) {
+	payload := strings.Repeat("x", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(payload))
+	}))
+	defer server.Close()
+
+	routes := []config.Route{
+		{Path: "/a", Target: server.URL},
+		{Path: "/b", Target: server.URL},
+	}
+
+	handler, err := NewHandlerWithBandwidth(routes, config.Bandwidth{Download: 10000})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	serve := func(path string) time.Duration {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+		handler.Handle(c)
+		if rec.Body.Len() != len(payload) {
+			t.Errorf("Expected %d bytes, got %d", len(payload), rec.Body.Len())
+		}
+		return time.Since(start)
+	}
+
+	// The first download spends the whole burst, which /b must not refill
+	serve("/a")
+	if elapsed := serve("/b"); elapsed < 500*time.Millisecond {
+		t.Errorf("Expected global limit to be shared across routes, second download took %v", elapsed)
+	}
+}
+
+func TestHandleMultipleTargets(t *testing.T) {
+	var servers []*httptest.Server
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + r.URL.Path))
+		}))
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	routes := []config.Route{
+		{Path: "/api", Targets: []config.Upstream{
+			{URL: servers[0].URL, Weight: 1},
+			{URL: servers[1].URL, Weight: 1},
+			{URL: servers[2].URL, Weight: 1},
+		}},
+	}
+
+	handler, err := NewHandler(routes)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	counts := make(map[string]int)
+
+	for i := 0; i < 6; i++ {
+		rec := httptest.NewRecorder()
+		w := &responseWriterWrapper{rec}
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		handler.Handle(c)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		counts[rec.Body.String()]++
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name+":/api/users"] != 2 {
+			t.Errorf("Expected target %s to receive 2 requests, got %d (%v)", name, counts[name+":/api/users"], counts)
+		}
+	}
+}
+
+func TestHandleTargetBasePath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	handler, err := NewHandler([]config.Route{
+		{Path: "/api", Target: server.URL + "/base?key=1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	w := &responseWriterWrapper{rec}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/users?page=2", nil)
+	handler.Handle(c)
+
+	if rec.Body.String() != "/base/api/users?key=1&page=2" {
+		t.Errorf("Expected target base path and query to be joined, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleTracksInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	routes := []config.Route{{
+		Path:          "/api",
+		Targets:       []config.Upstream{{URL: slow.URL, Weight: 1}, {URL: fast.URL, Weight: 1}},
+		LoadBalancing: config.LoadBalancing{Strategy: StrategyLeastConn},
+	}}
+
+	handler, err := NewHandler(routes)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		w := &responseWriterWrapper{rec}
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/report", nil)
+		handler.Handle(c)
+		return rec.Body.String()
+	}
+
+	done := make(chan string)
+	go func() { done <- serve() }()
+	<-started
+
+	balancer := handler.Balancer("/api")
+	if balancer.InFlight(slow.URL) != 1 {
+		t.Errorf("Expected 1 in-flight request on slow target, got %d", balancer.InFlight(slow.URL))
+	}
+
+	for i := 0; i < 3; i++ {
+		if body := serve(); body != "fast" {
+			t.Errorf("Expected least-conn to avoid the busy target, got %s", body)
+		}
+	}
+
+	close(release)
+	<-done
+
+	if balancer.InFlight(slow.URL) != 0 {
+		t.Errorf("Expected in-flight count to drop after completion, got %d", balancer.InFlight(slow.URL))
+	}
+}
+
+func TestHandleEWMARecordsLatency(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	routes := []config.Route{{
+		Path:          "/api",
+		Targets:       []config.Upstream{{URL: slow.URL, Weight: 1}, {URL: fast.URL, Weight: 1}},
+		LoadBalancing: config.LoadBalancing{Strategy: StrategyEWMA},
+	}}
+
+	handler, err := NewHandler(routes)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	counts := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		rec := httptest.NewRecorder()
+		w := &responseWriterWrapper{rec}
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/query", nil)
+		handler.Handle(c)
+		counts[rec.Body.String()]++
+	}
+
+	balancer := handler.Balancer("/api")
+	if balancer.Latency(slow.URL) < 20*time.Millisecond {
+		t.Errorf("Expected slow target latency to be recorded, got %v", balancer.Latency(slow.URL))
+	}
+	if counts["slow"] > 2 {
+		t.Errorf("Expected traffic to move to the fast target, got %v", counts)
+	}
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+const (
+	// retryBudgetWindow is the period over which the retry budget compares
+	// retries against requests, split into one-second buckets.
+	retryBudgetWindow = 10
+)
+
+/*
+retryPolicy decides whether a failed upstream attempt is sent again and
+enforces the retry budget of a route.
+*/
+type retryPolicy struct {
+	cfg    config.Retry
+	on     map[string]bool
+	budget *retryBudget
+}
+
+func newRetryPolicy(cfg *config.Retry) *retryPolicy {
+	if cfg == nil || cfg.Attempts < 2 {
+		return nil
+	}
+
+	p := &retryPolicy{
+		cfg:    *cfg,
+		on:     make(map[string]bool),
+		budget: newRetryBudget(cfg.BudgetPercent/100, cfg.MinRetriesPerSecond),
+	}
+	for _, condition := range cfg.RetryOn {
+		p.on[condition] = true
+	}
+	return p
+}
+
+/*
+idempotent reports whether requests with the method may be retried.
+*/
+func (p *retryPolicy) idempotent(method string) bool {
+	if p.cfg.NonIdempotent {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+/*
+retryable reports whether the outcome of an attempt is a failure the route
+is configured to retry. Errors caused by the client going away never are.
+*/
+func (p *retryPolicy) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		switch {
+		case p.on["error"]:
+			return true
+		case p.on["connect_failure"] && isConnectFailure(err):
+			return true
+		case p.on["timeout"] && isTimeout(err):
+			return true
+		case p.on["gateway_error"] && isConnectFailure(err):
+			return true
+		}
+		return false
+	}
+
+	status := resp.StatusCode
+	switch {
+	case p.on["5xx"] && status >= http.StatusInternalServerError:
+		return true
+	case p.on["gateway_error"] && (status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout):
+		return true
+	}
+	return slices.Contains(p.cfg.StatusCodes, status)
+}
+
+func isConnectFailure(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+/*
+backoff returns the delay before the given retry, using exponential backoff
+with full jitter so retries from many clients do not arrive in lockstep.
+*/
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.cfg.Backoff << min(retry-1, 30)
+	if ceiling > p.cfg.MaxBackoff || ceiling <= 0 {
+		ceiling = p.cfg.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+/*
+bufferBody reads up to MaxBodySize bytes of the request body so it can be
+replayed on retries. Larger bodies are streamed through unchanged and the
+request is marked as not replayable.
+*/
+func (p *retryPolicy) bufferBody(req *http.Request) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	limit := int64(p.cfg.MaxBodySize)
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(buf)) > limit {
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return nil, false, nil
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(buf))
+	req.ContentLength = int64(len(buf))
+	return buf, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+/*
+retryBudget allows retries up to a ratio of the requests seen over the last
+retryBudgetWindow seconds plus a fixed number per second, so a failing
+upstream cannot multiply the load on the remaining ones.
+*/
+type retryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	minPerSec int
+	epoch     int64
+	requests  [retryBudgetWindow]int
+	retries   [retryBudgetWindow]int
+}
+
+func newRetryBudget(ratio float64, minPerSec int) *retryBudget {
+	return &retryBudget{ratio: ratio, minPerSec: minPerSec}
+}
+
+func (b *retryBudget) advance(now time.Time) int {
+	sec := now.Unix()
+	if gap := sec - b.epoch; gap > 0 {
+		for i := int64(1); i <= min(gap, retryBudgetWindow); i++ {
+			idx := (b.epoch + i) % retryBudgetWindow
+			b.requests[idx] = 0
+			b.retries[idx] = 0
+		}
+		b.epoch = sec
+	}
+	return int(sec % retryBudgetWindow)
+}
+
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests[b.advance(time.Now())]++
+}
+
+/*
+withdraw reserves one retry if the budget allows it.
+*/
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	idx := b.advance(time.Now())
+
+	requests, retries := 0, 0
+	for i := range b.requests {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+
+	allowed := b.ratio*float64(requests) + float64(b.minPerSec*retryBudgetWindow)
+	if float64(retries) >= allowed {
+		return false
+	}
+	b.retries[idx]++
+	return true
+}
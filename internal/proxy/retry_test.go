@@ -0,0 +1,320 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func newRetryRoute(targets []string, retry config.Retry) config.Route {
+	route := config.Route{Path: "/api", Retry: &retry}
+	for _, target := range targets {
+		route.Targets = append(route.Targets, config.Upstream{URL: target, Weight: 1})
+	}
+	return route
+}
+
+func serveRetry(handler *Handler, method, body string) (int, string) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(method, "/api/items", strings.NewReader(body))
+	handler.Handle(c)
+	c.Writer.WriteHeaderNow()
+	return rec.Code, rec.Body.String()
+}
+
+func TestHandleRetriesOnOtherTarget(t *testing.T) {
+	var brokenHits atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits.Add(1)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + ":" + r.URL.Path + ":" + string(body)))
+	}))
+	defer healthy.Close()
+
+	retry := config.Retry{
+		Attempts:            2,
+		RetryOn:             []string{"gateway_error"},
+		BudgetPercent:       100,
+		MinRetriesPerSecond: 10,
+		MaxBodySize:         1024,
+	}
+
+	handler, err := NewHandler([]config.Route{newRetryRoute([]string{broken.URL, healthy.URL}, retry)})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		code, body := serveRetry(handler, http.MethodPut, "payload")
+		if code != http.StatusOK || body != "PUT:/api/items:payload" {
+			t.Errorf("Expected retried PUT to succeed with replayed body, got %d %q", code, body)
+		}
+	}
+	if brokenHits.Load() == 0 {
+		t.Error("Expected some requests to hit the broken target first")
+	}
+
+	// POST is not idempotent, so failures on the broken target are returned as-is
+	failures := 0
+	for i := 0; i < 6; i++ {
+		if code, _ := serveRetry(handler, http.MethodPost, "payload"); code == http.StatusServiceUnavailable {
+			failures++
+		}
+	}
+	if failures == 0 {
+		t.Error("Expected POST requests not to be retried")
+	}
+
+	retry.NonIdempotent = true
+	handler, err = NewHandler([]config.Route{newRetryRoute([]string{broken.URL, healthy.URL}, retry)})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if code, body := serveRetry(handler, http.MethodPost, "payload"); code != http.StatusOK || body != "POST:/api/items:payload" {
+			t.Errorf("Expected opted-in POST to be retried, got %d %q", code, body)
+		}
+	}
+}
+
+func TestHandleRetryKeepsRotation(t *testing.T) {
+	var brokenHits, healthyHits atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthyHits.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	handler, err := NewHandler([]config.Route{newRetryRoute([]string{broken.URL, healthy.URL}, config.Retry{
+		Attempts:            2,
+		RetryOn:             []string{"5xx"},
+		BudgetPercent:       100,
+		MinRetriesPerSecond: 10,
+	})})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if code, _ := serveRetry(handler, http.MethodGet, ""); code != http.StatusOK {
+			t.Errorf("Expected request to be retried onto the healthy target, got %d", code)
+		}
+	}
+	// Retries must not advance the round-robin, or the broken target would
+	// take the first attempt of every request
+	if got := brokenHits.Load(); got != 3 {
+		t.Errorf("Expected 3 of 6 first attempts on the broken target, got %d", got)
+	}
+	if got := healthyHits.Load(); got != 6 {
+		t.Errorf("Expected every request to end on the healthy target, got %d", got)
+	}
+}
+
+func TestHandleRetryUpstreamHeader(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header.Values("X-Upstream"), ",") + "|" + r.Header.Get("X-Route")))
+	}))
+	defer healthy.Close()
+
+	route := newRetryRoute([]string{broken.URL, healthy.URL}, config.Retry{
+		Attempts:            2,
+		RetryOn:             []string{"5xx"},
+		BudgetPercent:       100,
+		MinRetriesPerSecond: 10,
+	})
+	route.RequestHeaders = &config.HeaderRules{
+		Set: map[string]string{"X-Route": "{route}"},
+		Add: map[string]string{"X-Upstream": "{upstream}"},
+	}
+	handler, err := NewHandler([]config.Route{route})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	expected := healthy.URL + "|/api"
+	for i := 0; i < 4; i++ {
+		if code, body := serveRetry(handler, http.MethodGet, ""); code != http.StatusOK || body != expected {
+			t.Errorf("Expected retry to carry its own upstream %q, got %d %q", expected, code, body)
+		}
+	}
+}
+
+func TestHandleRetriesConnectFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	handler, err := NewHandler([]config.Route{newRetryRoute([]string{closed, healthy.URL}, config.Retry{
+		Attempts:            3,
+		RetryOn:             []string{"connect_failure"},
+		BudgetPercent:       20,
+		MinRetriesPerSecond: 10,
+		MaxBodySize:         1024,
+	})})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if code, body := serveRetry(handler, http.MethodGet, ""); code != http.StatusOK || body != "ok" {
+			t.Errorf("Expected connect failure to be retried, got %d %q", code, body)
+		}
+	}
+
+	if inFlight := handler.Balancer("/api").InFlight(closed); inFlight != 0 {
+		t.Errorf("Expected failed attempts to be released, got %d in flight", inFlight)
+	}
+}
+
+func TestHandleRetryPerTryTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	handler, err := NewHandler([]config.Route{newRetryRoute([]string{slow.URL, fast.URL}, config.Retry{
+		Attempts:            2,
+		PerTryTimeout:       50 * time.Millisecond,
+		RetryOn:             []string{"timeout"},
+		BudgetPercent:       100,
+		MinRetriesPerSecond: 10,
+		MaxBodySize:         1024,
+	})})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if code, body := serveRetry(handler, http.MethodGet, ""); code != http.StatusOK || body != "fast" {
+			t.Errorf("Expected timed out attempt to be retried, got %d %q", code, body)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected per-try timeout to cut slow attempts short, took %v", elapsed)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: io.EOF}
+	readErr := &net.OpError{Op: "read", Err: io.EOF}
+
+	tests := []struct {
+		name      string
+		retryOn   []string
+		codes     []int
+		status    int
+		err       error
+		retryable bool
+	}{
+		{"connect failure", []string{"connect_failure"}, nil, 0, dialErr, true},
+		{"read error is not a connect failure", []string{"connect_failure"}, nil, 0, readErr, false},
+		{"any error", []string{"error"}, nil, 0, readErr, true},
+		{"timeout", []string{"timeout"}, nil, 0, context.DeadlineExceeded, true},
+		{"gateway error 502", []string{"gateway_error"}, nil, http.StatusBadGateway, nil, true},
+		{"gateway error ignores 500", []string{"gateway_error"}, nil, http.StatusInternalServerError, nil, false},
+		{"5xx", []string{"5xx"}, nil, http.StatusInternalServerError, nil, true},
+		{"explicit status code", nil, []int{http.StatusTooManyRequests}, http.StatusTooManyRequests, nil, true},
+		{"success", []string{"5xx"}, nil, http.StatusOK, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRetryPolicy(&config.Retry{Attempts: 2, RetryOn: tt.retryOn, StatusCodes: tt.codes})
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := p.retryable(context.Background(), resp, tt.err); got != tt.retryable {
+				t.Errorf("Expected retryable %v, got %v", tt.retryable, got)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := newRetryPolicy(&config.Retry{Attempts: 2, RetryOn: []string{"error"}})
+	if p.retryable(ctx, nil, context.Canceled) {
+		t.Error("Expected requests cancelled by the client not to be retried")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(0.1, 0)
+
+	for i := 0; i < 20; i++ {
+		budget.request()
+	}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if budget.withdraw() {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected 10%% of 20 requests to allow 2 retries, got %d", allowed)
+	}
+}
+
+func TestRetryBufferBodyLimit(t *testing.T) {
+	p := newRetryPolicy(&config.Retry{Attempts: 2, MaxBodySize: 4})
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("0123456789"))
+	body, replayable, err := p.bufferBody(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replayable || body != nil {
+		t.Error("Expected body over the limit not to be replayable")
+	}
+
+	rest, _ := io.ReadAll(req.Body)
+	if string(rest) != "0123456789" {
+		t.Errorf("Expected oversized body to be streamed intact, got %q", rest)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+pathRewriter maps the public request path of a route to the path the
+upstream expects: the strip prefix is removed first, then the regex rewrite
+is applied and finally the add prefix is prepended. The strip prefix must
+cover whole path segments. It works on the escaped
+path so encoded characters such as %2F survive the rewrite. A rewrite without
+its own regex reuses the pattern of a regex or glob route.
+*/
+type pathRewriter struct {
+	strip       string
+	add         string
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func newPathRewriter(route config.Route, pattern *regexp.Regexp) (*pathRewriter, error) {
+	if route.StripPrefix == "" && route.AddPrefix == "" && route.Rewrite == nil {
+		return nil, nil
+	}
+
+	pr := &pathRewriter{
+		strip: route.StripPrefix,
+		add:   strings.TrimSuffix(route.AddPrefix, "/"),
+	}
+
+	if route.Rewrite != nil {
+		pr.regex = pattern
+		if route.Rewrite.Regex != "" || pattern == nil {
+			regex, err := regexp.Compile(route.Rewrite.Regex)
+			if err != nil {
+				return nil, err
+			}
+			pr.regex = regex
+		}
+		pr.replacement = route.Rewrite.Replacement
+	}
+
+	return pr, nil
+}
+
+func (pr *pathRewriter) rewrite(path string) string {
+	// Only whole segments are stripped, so /api leaves /apiary alone
+	if pr.strip != "" && strings.HasPrefix(path, pr.strip) && atBoundary(path, len(pr.strip)) {
+		path = strings.TrimPrefix(path, pr.strip)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	if pr.regex != nil {
+		path = pr.regex.ReplaceAllString(path, pr.replacement)
+	}
+
+	if pr.add != "" {
+		path = pr.add + path
+	}
+
+	return path
+}
+
+func (pr *pathRewriter) apply(u *url.URL) {
+	escaped := pr.rewrite(u.EscapedPath())
+
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path = path
+	u.RawPath = ""
+	if u.EscapedPath() != escaped {
+		u.RawPath = escaped
+	}
+}
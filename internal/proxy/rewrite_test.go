@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestPathRewriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    config.Route
+		path     string
+		expected string
+	}{
+		{"strip prefix", config.Route{StripPrefix: "/api"}, "/api/users", "/users"},
+		{"strip whole path", config.Route{StripPrefix: "/api"}, "/api", "/"},
+		{"strip prefix not matching", config.Route{StripPrefix: "/api"}, "/auth/login", "/auth/login"},
+		{"strip prefix inside a segment", config.Route{StripPrefix: "/api"}, "/apiary/x", "/apiary/x"},
+		{"strip prefix with trailing slash", config.Route{StripPrefix: "/api/"}, "/api/users", "/users"},
+		{"add prefix", config.Route{AddPrefix: "/v2"}, "/users", "/v2/users"},
+		{"add prefix with trailing slash", config.Route{AddPrefix: "/v2/"}, "/users", "/v2/users"},
+		{"strip and add", config.Route{StripPrefix: "/api", AddPrefix: "/internal"}, "/api/users/1", "/internal/users/1"},
+		{
+			"regex with captures",
+			config.Route{Rewrite: &config.Rewrite{Regex: `^/users/(\d+)/posts$`, Replacement: "/posts/by-user/$1"}},
+			"/users/42/posts", "/posts/by-user/42",
+		},
+		{
+			"regex with named captures",
+			config.Route{Rewrite: &config.Rewrite{Regex: `^/(?P<version>v\d)/(?P<rest>.*)$`, Replacement: "/${rest}/${version}"}},
+			"/v1/items", "/items/v1",
+		},
+		{
+			"strip then regex",
+			config.Route{StripPrefix: "/api", Rewrite: &config.Rewrite{Regex: `^/old/`, Replacement: "/new/"}},
+			"/api/old/page", "/new/page",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, err := newPathRewriter(tt.route, nil)
+			if err != nil {
+				t.Fatalf("Failed to create rewriter: %v", err)
+			}
+			if got := pr.rewrite(tt.path); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPathRewriterKeepsEscapes(t *testing.T) {
+	pr, _ := newPathRewriter(config.Route{StripPrefix: "/api"}, nil)
+
+	u, _ := url.Parse("/api/files/a%2Fb")
+	pr.apply(u)
+
+	if u.Path != "/files/a/b" || u.EscapedPath() != "/files/a%2Fb" {
+		t.Errorf("Expected escaped slash to survive, got path %s escaped %s", u.Path, u.EscapedPath())
+	}
+}
+
+func TestHandlePathRewrite(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path:        "/api",
+		Target:      backend.URL + "/service",
+		StripPrefix: "/api",
+		AddPrefix:   "/v1",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/users?page=2", nil)
+	handler.Handle(c)
+
+	if rec.Body.String() != "/service/v1/users?page=2" {
+		t.Errorf("Expected /service/v1/users?page=2, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+routeTree is a compressed radix tree over route paths. Static text is stored
+on shared edges, while ":name" segments and a trailing "*name" are child
+nodes capturing one segment or the rest of the path. A ':' or '*' inside a
+segment is plain text. A route matches a
+request path when its pattern covers the path up to a segment boundary, so
+/api matches /api and /api/users but not /apix.
+*/
+type routeTree struct {
+	root *treeNode
+}
+
+type treeNode struct {
+	prefix    string
+	name      string
+	statics   []*treeNode
+	params    []*treeNode
+	wildcards []*treeNode
+	routes    []int
+}
+
+/*
+pathMatch is one route whose path covers the request path. Literal counts
+the static bytes of a tree pattern and dynamic its parameter and wildcard
+segments; together they rank how specifically the route matched. Regex and
+glob routes are matched outside the tree and marked as pattern matches.
+*/
+type pathMatch struct {
+	route   int
+	literal int
+	dynamic int
+	pattern bool
+	params  map[string]string
+}
+
+type pathParam struct {
+	name  string
+	value string
+}
+
+func newRouteTree() *routeTree {
+	return &routeTree{root: &treeNode{}}
+}
+
+/*
+insert adds the route with index idx under pattern. A ':' or '*' only
+introduces a parameter or wildcard at the start of a segment; elsewhere it
+is literal, as in /v1/items:batch.
+*/
+func (t *routeTree) insert(pattern string, idx int) error {
+	n := t.root
+	for i := 0; i < len(pattern); {
+		rest := pattern[i:]
+		if !isDynamicSegment(pattern, i) {
+			end := 1
+			for end < len(rest) && !isDynamicSegment(pattern, i+end) {
+				end++
+			}
+			n = n.insertStatic(rest[:end])
+			i += end
+			continue
+		}
+
+		end := strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		name := rest[1:end]
+		switch {
+		case name == "" || strings.ContainsAny(name, ":*"):
+			return fmt.Errorf("path %s: invalid parameter %s", pattern, rest[:end])
+		case rest[0] == '*' && end != len(rest):
+			return fmt.Errorf("path %s: wildcard %s must be the last segment", pattern, rest[:end])
+		}
+
+		if rest[0] == '*' {
+			n = child(&n.wildcards, name)
+		} else {
+			n = child(&n.params, name)
+		}
+		i += end
+	}
+
+	n.routes = append(n.routes, idx)
+	return nil
+}
+
+func isDynamicSegment(pattern string, i int) bool {
+	return i > 0 && pattern[i-1] == '/' && (pattern[i] == ':' || pattern[i] == '*')
+}
+
+func child(children *[]*treeNode, name string) *treeNode {
+	for _, c := range *children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &treeNode{name: name}
+	*children = append(*children, c)
+	return c
+}
+
+func (n *treeNode) insertStatic(s string) *treeNode {
+	for s != "" {
+		var edge *treeNode
+		for _, c := range n.statics {
+			if c.prefix[0] == s[0] {
+				edge = c
+				break
+			}
+		}
+		if edge == nil {
+			c := &treeNode{prefix: s}
+			n.statics = append(n.statics, c)
+			return c
+		}
+
+		common := commonPrefix(edge.prefix, s)
+		if common < len(edge.prefix) {
+			tail := &treeNode{
+				prefix:    edge.prefix[common:],
+				statics:   edge.statics,
+				params:    edge.params,
+				wildcards: edge.wildcards,
+				routes:    edge.routes,
+			}
+			edge.prefix = edge.prefix[:common]
+			edge.statics = []*treeNode{tail}
+			edge.params, edge.wildcards, edge.routes = nil, nil, nil
+		}
+
+		n = edge
+		s = s[common:]
+	}
+	return n
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+/*
+lookup returns every route whose pattern covers path.
+*/
+func (t *routeTree) lookup(path string) []pathMatch {
+	var matches []pathMatch
+	t.root.collect(path, 0, 0, 0, nil, &matches)
+	return matches
+}
+
+func (n *treeNode) collect(path string, pos, literal, dynamic int, params []pathParam, out *[]pathMatch) {
+	if len(n.routes) > 0 && atBoundary(path, pos) {
+		for _, idx := range n.routes {
+			*out = append(*out, pathMatch{route: idx, literal: literal, dynamic: dynamic, params: paramMap(params)})
+		}
+	}
+
+	rest := path[pos:]
+	for _, c := range n.statics {
+		if strings.HasPrefix(rest, c.prefix) {
+			c.collect(path, pos+len(c.prefix), literal+len(c.prefix), dynamic, params, out)
+		}
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		if end > 0 {
+			for _, c := range n.params {
+				c.collect(path, pos+end, literal, dynamic+1, append(params[:len(params):len(params)], pathParam{c.name, rest[:end]}), out)
+			}
+		}
+	}
+
+	for _, c := range n.wildcards {
+		captured := append(params[:len(params):len(params)], pathParam{c.name, rest})
+		for _, idx := range c.routes {
+			*out = append(*out, pathMatch{route: idx, literal: literal, dynamic: dynamic + 1, params: paramMap(captured)})
+		}
+	}
+}
+
+/*
+atBoundary reports whether a pattern ending at pos covers whole segments of
+path: the path ends there, continues with a new segment, or the pattern
+itself ended with a slash.
+*/
+func atBoundary(path string, pos int) bool {
+	return pos == len(path) || path[pos] == '/' || (pos > 0 && path[pos-1] == '/')
+}
+
+func paramMap(params []pathParam) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(params))
+	for _, p := range params {
+		m[p.name] = p.value
+	}
+	return m
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestRouteTreeLookup(t *testing.T) {
+	patterns := []string{
+		"/",
+		"/api",
+		"/api/v2",
+		"/apix",
+		"/users/:id",
+		"/users/me",
+		"/users/:id/posts",
+		"/files/*rest",
+		"/static/",
+		"/v1/items:batch",
+		"/v1/items",
+	}
+
+	tree := newRouteTree()
+	for i, pattern := range patterns {
+		if err := tree.insert(pattern, i); err != nil {
+			t.Fatalf("Failed to insert %s: %v", pattern, err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+		params   map[string]string
+	}{
+		{"/api", "/api", nil},
+		{"/api/users", "/api", nil},
+		{"/apix/users", "/apix", nil},
+		{"/apiv", "/", nil},
+		{"/api/v2/users", "/api/v2", nil},
+		{"/api/v20", "/api", nil},
+		{"/users/42", "/users/:id", map[string]string{"id": "42"}},
+		{"/users/me", "/users/me", nil},
+		{"/users/42/posts/7", "/users/:id/posts", map[string]string{"id": "42"}},
+		{"/users/42/postsx", "/users/:id", map[string]string{"id": "42"}},
+		{"/files/a/b.txt", "/files/*rest", map[string]string{"rest": "a/b.txt"}},
+		{"/static/app.js", "/static/", nil},
+		{"/static", "/", nil},
+		{"/v1/items:batch", "/v1/items:batch", nil},
+		{"/v1/items:batchx", "/", nil},
+		{"/v1/items/7", "/v1/items", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var best *pathMatch
+			for _, m := range tree.lookup(tt.path) {
+				candidate := routeCandidate{rp: &routeProxy{matcher: &routeMatcher{}}, path: m}
+				if best == nil || candidate.outranks(routeCandidate{rp: candidate.rp, path: *best}) {
+					best = &m
+				}
+			}
+			if best == nil {
+				t.Fatalf("Expected %s to match %s, got no match", tt.path, tt.expected)
+			}
+			if got := patterns[best.route]; got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+			if len(best.params) != len(tt.params) {
+				t.Fatalf("Expected params %v, got %v", tt.params, best.params)
+			}
+			for k, v := range tt.params {
+				if best.params[k] != v {
+					t.Errorf("Expected param %s=%s, got %s", k, v, best.params[k])
+				}
+			}
+		})
+	}
+}
+
+func TestRouteTreeInsertErrors(t *testing.T) {
+	tests := []string{
+		"/users/:",
+		"/users/:id:x",
+		"/files/*rest/meta",
+	}
+
+	for _, pattern := range tests {
+		if err := newRouteTree().insert(pattern, 0); err == nil {
+			t.Errorf("Expected error for %s", pattern)
+		}
+	}
+}
+
+func TestHandlePathParams(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-User-ID")))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path:           "/users/:id",
+		Target:         backend.URL,
+		RequestHeaders: &config.HeaderRules{Set: map[string]string{"X-User-ID": "{param.id}"}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(http.MethodGet, "/users/42/profile", nil)
+	handler.Handle(c)
+
+	if rec.Body.String() != "42" {
+		t.Errorf("Expected path parameter 42, got %s", rec.Body.String())
+	}
+}
+
+// benchmarkPaths builds n routes spread over a few hundred top-level
+// prefixes, similar to a large multi-tenant configuration.
+func benchmarkPaths(n int) []string {
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/tenant%d/service%d/v%d", i%300, i, i%3)
+	}
+	return paths
+}
+
+func BenchmarkRouteTreeLookup(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		paths := benchmarkPaths(n)
+		tree := newRouteTree()
+		for i, path := range paths {
+			tree.insert(path, i)
+		}
+		request := paths[n/2] + "/items/42"
+
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if len(tree.lookup(request)) == 0 {
+					b.Fatal("Expected a match")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLinearScan measures the prefix loop the radix tree replaced.
+func BenchmarkLinearScan(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		paths := benchmarkPaths(n)
+		request := paths[n/2] + "/items/42"
+
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				matched := -1
+				for j, path := range paths {
+					if strings.HasPrefix(request, path) && (matched < 0 || len(path) > len(paths[matched])) {
+						matched = j
+					}
+				}
+				if matched < 0 {
+					b.Fatal("Expected a match")
+				}
+			}
+		})
+	}
+}
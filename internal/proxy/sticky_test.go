@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func newStickyHandler(t *testing.T, names ...string) (*Handler, []*httptest.Server) {
+	var servers []*httptest.Server
+	var upstreams []config.Upstream
+	for _, name := range names {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		servers = append(servers, server)
+		upstreams = append(upstreams, config.Upstream{URL: server.URL, Weight: 1})
+	}
+
+	httpOnly := true
+	handler, err := NewHandler([]config.Route{{
+		Path:    "/app",
+		Targets: upstreams,
+		StickySession: &config.StickySession{
+			CookieName: "affinity",
+			Secret:     "test-secret",
+			TTL:        time.Hour,
+			Path:       "/",
+			HTTPOnly:   &httpOnly,
+			SameSite:   "lax",
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	return handler, servers
+}
+
+func serveWithCookie(handler *Handler, cookie *http.Cookie) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+	c.Request = httptest.NewRequest(http.MethodGet, "/app", nil)
+	if cookie != nil {
+		c.Request.AddCookie(cookie)
+	}
+	handler.Handle(c)
+	return rec
+}
+
+func affinityCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "affinity" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestStickySessionPinsClient(t *testing.T) {
+	handler, servers := newStickyHandler(t, "a", "b", "c")
+
+	rec := serveWithCookie(handler, nil)
+	cookie := affinityCookie(rec)
+	if cookie == nil {
+		t.Fatal("Expected affinity cookie on first response")
+	}
+	if !cookie.HttpOnly || cookie.MaxAge != 3600 || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected configured cookie attributes, got %+v", cookie)
+	}
+	for _, server := range servers {
+		if strings.Contains(cookie.Value, server.URL) {
+			t.Errorf("Expected cookie not to expose upstream URL, got %s", cookie.Value)
+		}
+	}
+
+	first := rec.Body.String()
+	for i := 0; i < 10; i++ {
+		rec := serveWithCookie(handler, cookie)
+		if rec.Body.String() != first {
+			t.Fatalf("Expected request %d to stick to %s, got %s", i, first, rec.Body.String())
+		}
+		if affinityCookie(rec) != nil {
+			t.Error("Expected no new cookie while the pinned target is healthy")
+		}
+	}
+}
+
+func TestStickySessionRejectsForgedCookie(t *testing.T) {
+	handler, _ := newStickyHandler(t, "a", "b")
+
+	cookie := affinityCookie(serveWithCookie(handler, nil))
+	parts := strings.Split(cookie.Value, ".")
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"tampered signature", parts[0] + "." + parts[1] + ".AAAA"},
+		{"extended expiry", parts[0] + ".9999999999." + parts[2]},
+		{"malformed", "garbage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveWithCookie(handler, &http.Cookie{Name: "affinity", Value: tt.value})
+			if affinityCookie(rec) == nil {
+				t.Error("Expected invalid cookie to be replaced")
+			}
+		})
+	}
+}
+
+func TestStickySessionExpiredCookie(t *testing.T) {
+	handler, _ := newStickyHandler(t, "a", "b")
+	sticky := handler.proxies[0].sticky
+
+	id := sticky.ids[handler.proxies[0].balancer.Targets()[0]]
+	expires := "1"
+	cookie := &http.Cookie{Name: "affinity", Value: id + "." + expires + "." + base64.RawURLEncoding.EncodeToString(sticky.sign(id, expires))}
+
+	if target := sticky.target(requestWithCookie(cookie)); target != "" {
+		t.Errorf("Expected expired cookie to be ignored, got %s", target)
+	}
+}
+
+func TestStickySessionFallsBackWhenTargetDrained(t *testing.T) {
+	handler, servers := newStickyHandler(t, "a", "b")
+
+	rec := serveWithCookie(handler, nil)
+	cookie := affinityCookie(rec)
+	pinned := rec.Body.String()
+
+	pinnedURL := servers[0].URL
+	if pinned == "b" {
+		pinnedURL = servers[1].URL
+	}
+	if err := handler.Balancer("/app").SetWeight(pinnedURL, 0); err != nil {
+		t.Fatalf("Failed to drain target: %v", err)
+	}
+
+	rec = serveWithCookie(handler, cookie)
+	if rec.Body.String() == pinned {
+		t.Errorf("Expected request to move off drained target %s", pinned)
+	}
+	if affinityCookie(rec) == nil {
+		t.Error("Expected client to be re-pinned to the new target")
+	}
+}
+
+func requestWithCookie(cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/app", nil)
+	req.AddCookie(cookie)
+	return req
+}
+
+func TestStickySessionAcrossRoutes(t *testing.T) {
+	var upstreams []config.Upstream
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer server.Close()
+		upstreams = append(upstreams, config.Upstream{URL: server.URL, Weight: 1})
+	}
+
+	// Cookie names as defaulted by the config loader
+	handler, err := NewHandler([]config.Route{
+		{Path: "/app", Targets: upstreams, StickySession: &config.StickySession{CookieName: "gothrottle_affinity_0", Secret: "s", Path: "/"}},
+		{Path: "/shop", Targets: upstreams, StickySession: &config.StickySession{CookieName: "gothrottle_affinity_1", Secret: "s", Path: "/"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	jar := make(map[string]*http.Cookie)
+	serve := func(path string) string {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range jar {
+			c.Request.AddCookie(cookie)
+		}
+		handler.Handle(c)
+		for _, cookie := range rec.Result().Cookies() {
+			jar[cookie.Name] = cookie
+		}
+		return rec.Body.String()
+	}
+
+	app, shop := serve("/app"), serve("/shop")
+	for i := 0; i < 10; i++ {
+		if got := serve("/app"); got != app {
+			t.Fatalf("Expected /app to stay on %s after visiting /shop, got %s", app, got)
+		}
+		if got := serve("/shop"); got != shop {
+			t.Fatalf("Expected /shop to stay on %s after visiting /app, got %s", shop, got)
+		}
+	}
+}
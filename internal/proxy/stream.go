@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+streamingTypes are the media types of responses produced over time rather
+than all at once: server-sent events and newline-delimited JSON.
+*/
+var streamingTypes = map[string]bool{
+	"text/event-stream":       true,
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/stream+json": true,
+}
+
+/*
+isStream reports whether resp is relayed as a stream: it has a streaming
+media type, or the route opted into streaming and the body has no known
+length, as with chunked long-poll responses. Streams are exempt from the
+request and per-try timeouts, since they last as long as the upstream keeps
+sending. Other chunked responses keep their timeouts, so a backend hanging
+mid-body cannot hold the client forever.
+*/
+func (rp *routeProxy) isStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if streamingTypes[mediaType] {
+		return true
+	}
+	return rp.route.Streaming && resp.ContentLength < 0
+}
+
+/*
+stream lifts the deadlines that would cut the response short once it is
+known to be a stream: the request timeout of the route and the write
+timeout of the server.
+*/
+func (ex *exchange) stream() {
+	ex.deadline.lift()
+	if ex.writer != nil {
+		http.NewResponseController(ex.writer).SetWriteDeadline(time.Time{})
+	}
+}
+
+/*
+deadline cancels a context once its timeout passes, like
+context.WithTimeout, but can be lifted before it does. Requests cancelled by
+it fail with context.DeadlineExceeded.
+*/
+type deadline struct {
+	timer *time.Timer
+}
+
+func withDeadline(parent context.Context, timeout time.Duration) (context.Context, *deadline, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	d := &deadline{timer: time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })}
+	return ctx, d, func() {
+		d.lift()
+		cancel(context.Canceled)
+	}
+}
+
+func (d *deadline) lift() {
+	if d != nil {
+		d.timer.Stop()
+	}
+}
+
+/*
+recoverClientGone swallows the http.ErrAbortHandler panic ReverseProxy
+raises when relaying a body fails after the client has gone away, which is
+how streams usually end. There is nobody left to signal the abort to, and
+letting the panic through would skip the request log. Aborts while the
+client is still connected keep propagating so it sees a truncated response.
+*/
+func recoverClientGone(c *gin.Context) {
+	if err := recover(); err != nil {
+		if err != http.ErrAbortHandler || c.Request.Context().Err() == nil {
+			panic(err)
+		}
+		c.Abort()
+	}
+}
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestIsStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		contentLength int64
+		streaming     bool
+		expected      bool
+	}{
+		{"event stream", "text/event-stream; charset=utf-8", -1, false, true},
+		{"ndjson", "application/x-ndjson", 512, false, true},
+		{"json", "application/json", 512, false, false},
+		{"chunked json", "application/json", -1, false, false},
+		{"chunked json on streaming route", "application/json", -1, true, true},
+		{"sized json on streaming route", "application/json", 512, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &routeProxy{route: config.Route{Streaming: tt.streaming, FlushInterval: -1}}
+			resp := &http.Response{
+				Header:        http.Header{"Content-Type": {tt.contentType}},
+				ContentLength: tt.contentLength,
+			}
+			if got := rp.isStream(resp); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+/*
+newStreamBackend sends one line, then a second once next is signalled, so
+tests can check the first arrives while the upstream is still producing.
+*/
+func newStreamBackend(contentType string, next <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-next:
+			fmt.Fprint(w, "second\n")
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func newStreamProxy(t *testing.T, route config.Route) *httptest.Server {
+	handler, err := NewHandler([]config.Route{route})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.NoRoute(handler.Handle)
+	return httptest.NewServer(router)
+}
+
+func TestHandleStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		streaming   bool
+	}{
+		{"server-sent events", "text/event-stream", false},
+		{"chunked long-poll on streaming route", "application/json", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := make(chan struct{})
+			backend := newStreamBackend(tt.contentType, next)
+			defer backend.Close()
+
+			proxy := newStreamProxy(t, config.Route{
+				Path:          "/events",
+				Target:        backend.URL,
+				Streaming:     tt.streaming,
+				FlushInterval: -1,
+				Transport:     config.Transport{RequestTimeout: 50 * time.Millisecond},
+				Retry:         &config.Retry{Attempts: 2, PerTryTimeout: 50 * time.Millisecond},
+			})
+			defer proxy.Close()
+
+			resp, err := http.Get(proxy.URL + "/events")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			reader := bufio.NewReader(resp.Body)
+
+			line, err := reader.ReadString('\n')
+			if err != nil || line != "first\n" {
+				t.Fatalf("Expected first line before the stream ends, got %q (%v)", line, err)
+			}
+
+			// Outlive the request and per-try timeouts
+			time.Sleep(100 * time.Millisecond)
+			close(next)
+
+			line, err = reader.ReadString('\n')
+			if err != nil || line != "second\n" {
+				t.Errorf("Expected stream to outlive the timeouts, got %q (%v)", line, err)
+			}
+		})
+	}
+}
+
+func TestHandleStreamTimeout(t *testing.T) {
+	next := make(chan struct{})
+	defer close(next)
+	backend := newStreamBackend("application/json", next)
+	defer backend.Close()
+
+	// A flush interval alone does not make chunked responses streams
+	proxy := newStreamProxy(t, config.Route{
+		Path:          "/poll",
+		Target:        backend.URL,
+		FlushInterval: -1,
+		Transport:     config.Transport{RequestTimeout: 50 * time.Millisecond},
+	})
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/poll")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(resp.Body).ReadString('\x00')
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected request timeout to cut off a response that is not a stream")
+	}
+}
+
+func TestHandleStreamClientGone(t *testing.T) {
+	next := make(chan struct{})
+	defer close(next)
+	backend := newStreamBackend("text/event-stream", next)
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{Path: "/events", Target: backend.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	served := make(chan any, 1)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		defer func() { served <- recover() }()
+		c.Next()
+	})
+	router.NoRoute(handler.Handle)
+	proxy := httptest.NewServer(router)
+	defer proxy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, proxy.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if !strings.HasPrefix(line, "first") {
+		t.Fatalf("Expected first line, got %q", line)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case p := <-served:
+		if p != nil {
+			t.Errorf("Expected client disconnect to end the stream quietly, got panic %v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected handler to return after the client went away")
+	}
+}
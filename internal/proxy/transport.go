@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+/*
+newHTTPTransport builds the connection pool of a route from its transport
+settings. Zero values fall back to the net/http defaults.
+*/
+func newHTTPTransport(cfg config.Transport) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+	}
+}
+
+/*
+upstreamTransport wraps the HTTP transport of a route to report per-target
+response times back to the balancer, to hedge slow requests and to retry
+failed attempts on other targets. Timing stops when response headers arrive, so slow clients reading
+the body do not skew the estimate.
+*/
+type upstreamTransport struct {
+	base http.RoundTripper
+	rp   *routeProxy
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ex, _ := req.Context().Value(exchangeKey{}).(*exchange)
+	if ex == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	retry := t.rp.retry
+	tried := []string{ex.target}
+
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		var err error
+		if attempt == 1 && t.rp.hedge != nil && t.rp.hedge.eligible(req) {
+			resp, tried, err = t.hedged(req, ex)
+		} else {
+			resp, err = t.attempt(req, ex.target)
+		}
+
+		if retry == nil || attempt >= retry.cfg.Attempts || !ex.replayable ||
+			!retry.idempotent(req.Method) || !retry.retryable(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		next := t.rp.balancer.PickOther(tried)
+		if next == "" || !retry.budget.withdraw() || !t.rp.begin(next) {
+			return resp, err
+		}
+
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		t.rp.finish(ex.target, true, failed)
+		ex.target = next
+		tried = append(tried, next)
+
+		select {
+		case <-time.After(retry.backoff(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		req = t.rp.cloneFor(req, ex, next)
+	}
+}
+
+/*
+attempt sends the request to target once, bounded by the per-try timeout.
+The timeout keeps applying while the response body is read, unless the
+response is a stream. Upgrades are not bounded, and their response body
+stays writable since it is the upgraded connection.
+*/
+func (t *upstreamTransport) attempt(req *http.Request, target string) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	var timeout *deadline
+	if t.rp.retry != nil && t.rp.retry.cfg.PerTryTimeout > 0 && !isUpgrade(req) {
+		var ctx context.Context
+		ctx, timeout, cancel = withDeadline(req.Context(), t.rp.retry.cfg.PerTryTimeout)
+		req = req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	rtt := time.Since(start)
+
+	// Attempts cancelled by the proxy say nothing about the target
+	if !errors.Is(err, context.Canceled) {
+		t.rp.balancer.Observe(target, rtt, err)
+	}
+	if err == nil && t.rp.hedge != nil {
+		t.rp.hedge.observe(rtt)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if conn, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+		resp.Body = &cancelOnCloseConn{ReadWriteCloser: conn, cancel: cancel}
+		return resp, nil
+	}
+	if t.rp.isStream(resp) {
+		timeout.lift()
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+type cancelOnCloseConn struct {
+	io.ReadWriteCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnCloseConn) Close() error {
+	err := c.ReadWriteCloser.Close()
+	c.cancel()
+	return err
+}
+
+/*
+cloneFor clones the outgoing request for another attempt, pointing it at
+target and replaying the buffered body. Header rules referring to
+{upstream} are applied again to the headers they started from.
+*/
+func (rp *routeProxy) cloneFor(req *http.Request, ex *exchange, target string) *http.Request {
+	next := req.Clone(req.Context())
+	next.URL = new(url.URL)
+	*next.URL = ex.inbound
+	rp.direct(next, target)
+	if ex.header != nil {
+		next.Header = ex.header.Clone()
+		rp.editRequestHeaders(next, ex, target)
+	}
+
+	if ex.body != nil {
+		next.Body = io.NopCloser(bytes.NewReader(ex.body))
+		next.ContentLength = int64(len(ex.body))
+	}
+	return next
+}
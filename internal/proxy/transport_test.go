@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	transport := newHTTPTransport(config.Transport{
+		DialTimeout:           time.Second,
+		TLSHandshakeTimeout:   2 * time.Second,
+		ResponseHeaderTimeout: 3 * time.Second,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       time.Minute,
+		KeepAlive:             15 * time.Second,
+		DisableKeepAlives:     true,
+	})
+
+	if transport.TLSHandshakeTimeout != 2*time.Second {
+		t.Errorf("Expected TLS handshake timeout 2s, got %v", transport.TLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != 3*time.Second {
+		t.Errorf("Expected response header timeout 3s, got %v", transport.ResponseHeaderTimeout)
+	}
+	if transport.MaxIdleConnsPerHost != 64 {
+		t.Errorf("Expected 64 idle connections per host, got %d", transport.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != time.Minute {
+		t.Errorf("Expected idle timeout 1m, got %v", transport.IdleConnTimeout)
+	}
+	if !transport.DisableKeepAlives {
+		t.Error("Expected keep-alives to be disabled")
+	}
+}
+
+func TestHandleUpstreamTimeouts(t *testing.T) {
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/body" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		transport config.Transport
+	}{
+		{"response header timeout", "/api/headers", config.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}},
+		{"request timeout", "/api/headers", config.Transport{RequestTimeout: 50 * time.Millisecond}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := NewHandler([]config.Route{{Path: "/api", Target: hung.URL, Transport: tt.transport}})
+			if err != nil {
+				t.Fatalf("Failed to create handler: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+			c.Request = httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			start := time.Now()
+			handler.Handle(c)
+
+			if rec.Code != http.StatusGatewayTimeout {
+				t.Errorf("Expected 504 from hung upstream, got %d", rec.Code)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected timeout to release the client quickly, took %v", elapsed)
+			}
+		})
+	}
+
+	// The request deadline also covers a response body that never finishes
+	handler, err := NewHandler([]config.Route{{Path: "/api", Target: hung.URL, Transport: config.Transport{RequestTimeout: 50 * time.Millisecond}}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(&responseWriterWrapper{rec})
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/body", nil)
+		handler.Handle(c)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected request timeout to end a stalled response body")
+	}
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/smartcraze/gothrottle/internal/clientip"
+	"github.com/smartcraze/gothrottle/internal/config"
+	"github.com/smartcraze/gothrottle/internal/ratelimit"
+)
+
+/*
+isUpgrade reports whether req asks to switch protocols, as WebSocket
+handshakes do. Upgraded connections live far longer than a request, so they
+are never hedged and are exempt from request and per-try timeouts.
+*/
+func isUpgrade(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWebSocket(req *http.Request) bool {
+	return isUpgrade(req) && strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+/*
+websocketLimiter enforces the WebSocket limits of a route: concurrent
+connections per client and the rate of messages clients send upstream.
+*/
+type websocketLimiter struct {
+	maxConns int
+	mu       sync.Mutex
+	conns    map[string]int
+	messages *ratelimit.Storage
+}
+
+func newWebSocketLimiter(cfg *config.WebSocket) *websocketLimiter {
+	if cfg == nil || (cfg.MaxConnectionsPerClient <= 0 && cfg.MessageRate <= 0) {
+		return nil
+	}
+
+	l := &websocketLimiter{
+		maxConns: cfg.MaxConnectionsPerClient,
+		conns:    make(map[string]int),
+	}
+	if cfg.MessageRate > 0 {
+		l.messages = ratelimit.NewStorage(cfg.MessageRate, cfg.MessageBurst)
+	}
+	return l
+}
+
+/*
+acquire counts a new connection for client, failing when the client already
+has the maximum number open. Every successful acquire must be paired with
+release.
+*/
+func (l *websocketLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxConns > 0 && l.conns[client] >= l.maxConns {
+		return false
+	}
+	l.conns[client]++
+	return true
+}
+
+func (l *websocketLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[client]--; l.conns[client] <= 0 {
+		delete(l.conns, client)
+	}
+}
+
+/*
+wrap makes the hijacked client connection count the messages it reads and
+hold them back once the client exceeds its message rate.
+*/
+func (l *websocketLimiter) wrap(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if l.messages == nil {
+		return w
+	}
+	return &messageLimitedWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		bucket:         l.messages.GetBucket(clientip.FromRequest(r)),
+	}
+}
+
+type messageLimitedWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	bucket *ratelimit.TokenBucket
+}
+
+func (w *messageLimitedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &messageLimitedConn{Conn: conn, ctx: w.ctx, bucket: w.bucket}, brw, nil
+}
+
+func (w *messageLimitedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+/*
+messageLimitedConn throttles the messages read from a client. Data already
+read is held back until the bucket covers the messages it completed, which
+pushes back on the client through TCP flow control.
+*/
+type messageLimitedConn struct {
+	net.Conn
+	ctx     context.Context
+	bucket  *ratelimit.TokenBucket
+	counter frameCounter
+}
+
+func (c *messageLimitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if messages := c.counter.scan(p[:n]); messages > 0 {
+		if werr := ratelimit.WaitN(c.ctx, c.bucket, messages); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+/*
+frameCounter follows the WebSocket frames (RFC 6455) in a byte stream and
+counts completed messages, that is data frames with the FIN bit set.
+Control frames such as pings are not counted.
+*/
+type frameCounter struct {
+	header    [14]byte
+	headerLen int
+	remaining uint64
+}
+
+func (f *frameCounter) scan(b []byte) int {
+	messages := 0
+	for len(b) > 0 {
+		if f.remaining > 0 {
+			skip := uint64(len(b))
+			if skip > f.remaining {
+				skip = f.remaining
+			}
+			f.remaining -= skip
+			b = b[skip:]
+			continue
+		}
+
+		f.header[f.headerLen] = b[0]
+		f.headerLen++
+		b = b[1:]
+
+		if f.headerLen < 2 || f.headerLen < frameHeaderSize(f.header[1]) {
+			continue
+		}
+
+		fin := f.header[0]&0x80 != 0
+		opcode := f.header[0] & 0x0f
+		if fin && opcode < 0x8 {
+			messages++
+		}
+
+		switch length := f.header[1] & 0x7f; length {
+		case 126:
+			f.remaining = uint64(binary.BigEndian.Uint16(f.header[2:4]))
+		case 127:
+			f.remaining = binary.BigEndian.Uint64(f.header[2:10])
+		default:
+			f.remaining = uint64(length)
+		}
+		f.headerLen = 0
+	}
+	return messages
+}
+
+/*
+frameHeaderSize returns the size of a frame header from its second byte,
+which holds the mask bit and the payload length.
+*/
+func frameHeaderSize(b byte) int {
+	size := 2
+	switch b & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if b&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/smartcraze/gothrottle/internal/config"
+)
+
+// wsFrame builds a masked client frame with an all-zero mask.
+func wsFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n < 1<<16:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	frame = append(frame, 0, 0, 0, 0)
+	return append(frame, payload...)
+}
+
+func TestFrameCounter(t *testing.T) {
+	text := wsFrame(true, 0x1, []byte("hello"))
+	large := wsFrame(true, 0x2, make([]byte, 300))
+	huge := wsFrame(true, 0x2, make([]byte, 70000))
+	first := wsFrame(false, 0x1, []byte("hel"))
+	cont := wsFrame(true, 0x0, []byte("lo"))
+	ping := wsFrame(true, 0x9, nil)
+
+	tests := []struct {
+		name     string
+		stream   [][]byte
+		expected int
+	}{
+		{"single text frame", [][]byte{text}, 1},
+		{"extended lengths", [][]byte{large, huge}, 2},
+		{"fragmented message", [][]byte{first, cont}, 1},
+		{"control frames are not messages", [][]byte{ping, text, ping}, 1},
+		{"split across reads", [][]byte{text[:1], text[1:4], text[4:], large[:3], large[3:]}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter frameCounter
+			messages := 0
+			for _, chunk := range tt.stream {
+				messages += counter.scan(chunk)
+			}
+			if messages != tt.expected {
+				t.Errorf("Expected %d messages, got %d", tt.expected, messages)
+			}
+		})
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if isUpgrade(req) {
+		t.Error("Expected plain request not to be an upgrade")
+	}
+
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if !isUpgrade(req) || !isWebSocket(req) {
+		t.Error("Expected WebSocket upgrade to be detected")
+	}
+
+	req.Header.Set("Upgrade", "h2c")
+	if isWebSocket(req) {
+		t.Error("Expected h2c upgrade not to be a WebSocket")
+	}
+}
+
+// newEchoBackend accepts any upgrade and echoes the raw bytes it receives.
+func newEchoBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+}
+
+func dialWebSocket(t *testing.T, addr string) (net.Conn, *bufio.Reader, int) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	conn.Write([]byte("GET /ws/feed HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	return conn, reader, resp.StatusCode
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	backend := newEchoBackend()
+	defer backend.Close()
+
+	handler, err := NewHandler([]config.Route{{
+		Path:      "/ws",
+		Target:    backend.URL,
+		WebSocket: &config.WebSocket{MaxConnectionsPerClient: 1, MessageRate: 1000, MessageBurst: 10},
+		Transport: config.Transport{RequestTimeout: 50 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.NoRoute(handler.Handle)
+	proxy := httptest.NewServer(router)
+	defer proxy.Close()
+	addr := proxy.Listener.Addr().String()
+
+	conn, reader, status := dialWebSocket(t, addr)
+	defer conn.Close()
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", status)
+	}
+
+	// Outlive the request timeout, which must not apply to upgrades
+	time.Sleep(100 * time.Millisecond)
+
+	frame := wsFrame(true, 0x1, []byte("ping"))
+	conn.Write(frame)
+	echo := make([]byte, len(frame))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(reader, echo); err != nil || string(echo) != string(frame) {
+		t.Fatalf("Expected frame to be echoed, got %q (%v)", echo, err)
+	}
+
+	second, _, status := dialWebSocket(t, addr)
+	second.Close()
+	if status != http.StatusTooManyRequests {
+		t.Errorf("Expected second connection from the same client to be rejected, got %d", status)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		third, _, status := dialWebSocket(t, addr)
+		third.Close()
+		if status == http.StatusSwitchingProtocols {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected slot to be released after close, got %d", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+/*
+WaitN reserves n tokens from the bucket and blocks until they are covered,
+returning early if the context is cancelled.
+*/
+func WaitN(ctx context.Context, bucket *TokenBucket, n int) error {
+	delay := bucket.ReserveN(float64(n))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+Reader throttles reads from an underlying stream to the rate of a token
+bucket holding byte tokens. Reads are capped at chunk bytes so throughput
+stays smooth instead of arriving in bucket-sized bursts.
+*/
+type Reader struct {
+	ctx    context.Context
+	r      io.ReadCloser
+	bucket *TokenBucket
+	chunk  int
+}
+
+func NewReader(ctx context.Context, r io.ReadCloser, bucket *TokenBucket, chunk int) *Reader {
+	return &Reader{ctx: ctx, r: r, bucket: bucket, chunk: chunk}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := WaitN(r.ctx, r.bucket, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	return r.r.Close()
+}
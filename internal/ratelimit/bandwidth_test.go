@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserveN(t *testing.T) {
+	tb := NewTokenBucket(1000, 1000)
+
+	if delay := tb.ReserveN(1000); delay != 0 {
+		t.Errorf("Expected no delay within burst, got %v", delay)
+	}
+
+	delay := tb.ReserveN(500)
+	if delay < 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Errorf("Expected ~500ms delay for 500 bytes of debt, got %v", delay)
+	}
+}
+
+func TestWaitNCancelled(t *testing.T) {
+	tb := NewTokenBucket(10, 10)
+	tb.ReserveN(10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := WaitN(ctx, tb, 100); err == nil {
+		t.Error("Expected error when context is cancelled")
+	}
+}
+
+func TestReaderThrottles(t *testing.T) {
+	tb := NewTokenBucket(10000, 10000)
+	payload := strings.Repeat("x", 15000)
+	r := NewReader(context.Background(), io.NopCloser(strings.NewReader(payload)), tb, 4096)
+
+	start := time.Now()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if len(data) != len(payload) {
+		t.Errorf("Expected %d bytes, got %d", len(payload), len(data))
+	}
+
+	// 10000 bytes come from the burst, the remaining 5000 take ~500ms
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected read to be throttled, took %v", elapsed)
+	}
+}
@@ -46,6 +46,24 @@ func (tb *TokenBucket) Allow() bool {
 	return false
 }
 
+/*
+ReserveN consumes n tokens unconditionally and returns how long the caller
+must wait before the bucket is back out of debt. Used for byte-rate limiting,
+where work is delayed rather than rejected.
+*/
+func (tb *TokenBucket) ReserveN(n float64) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+	tb.tokens -= n
+
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.refillRate * float64(time.Second))
+}
+
 func (tb *TokenBucket) refill() {
 	now := time.Now()
 	elapsed := now.Sub(tb.lastRefillTime).Seconds()